@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// LevelAdmin is an HTTP endpoint for inspecting and changing handler levels
+// of a running process. Only requests from the loopback interface that name a
+// loopback host are served. Changes must use PUT, which a web page can only
+// send cross-site after a CORS preflight that LevelAdmin never approves, and
+// the host check turns away pages that reach it through DNS rebinding.
+//
+//	GET /levels                              lists the level of every handler
+//	PUT /levels?handler=console&level=error  changes the level of one handler
+type LevelAdmin struct {
+	chain *Chain
+}
+
+func NewLevelAdmin(chain *Chain) *LevelAdmin {
+	return &LevelAdmin{chain: chain}
+}
+
+func (a *LevelAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isLoopback(r.RemoteAddr) || !isLoopbackHost(r.Host) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		query := r.URL.Query()
+		level, err := ParseLevel(query.Get("level"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = a.chain.SetLevel(query.Get("handler"), level)
+		switch {
+		case errors.Is(err, ErrUnknownHandler):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	levels := make(map[string]string)
+	for name, level := range a.chain.Levels() {
+		levels[name] = LevelName(level)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(levels)
+}
+
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isLoopbackHost reports whether a Host header names this machine
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return strings.EqualFold(host, "localhost") || isLoopback(host)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLevelAdmin(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		remote    string
+		target    string
+		wantCode  int
+		wantLevel int // of the console handler afterwards
+	}{
+		{"list levels", http.MethodGet, "127.0.0.1:5000", "http://localhost:6060/levels", 200, Info},
+		{"change a level", http.MethodPut, "127.0.0.1:5000", "http://127.0.0.1:6060/levels?handler=console&level=error", 200, Error},
+		{"change over IPv6", http.MethodPut, "[::1]:5000", "http://[::1]:6060/levels?handler=console&level=warning", 200, Warning},
+		{"host without a port", http.MethodPut, "127.0.0.1:5000", "http://localhost/levels?handler=console&level=error", 200, Error},
+		{"simple cross-site form", http.MethodPost, "127.0.0.1:5000", "http://127.0.0.1:6060/levels?handler=console&level=error", 405, Info},
+		{"remote client", http.MethodPut, "10.0.0.7:5000", "http://127.0.0.1:6060/levels?handler=console&level=error", 403, Info},
+		{"DNS rebinding", http.MethodPut, "127.0.0.1:5000", "http://attacker.example:6060/levels?handler=console&level=error", 403, Info},
+		{"unknown handler", http.MethodPut, "127.0.0.1:5000", "http://localhost:6060/levels?handler=nope&level=error", 404, Info},
+		{"unknown level", http.MethodPut, "127.0.0.1:5000", "http://localhost:6060/levels?handler=console&level=loud", 400, Info},
+		{"handler without a level", http.MethodPut, "127.0.0.1:5000", "http://localhost:6060/levels?handler=sink&level=error", 400, Info},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			console := NewConsoleLogger(Info, PassThrough)
+			chain := NewChain()
+			chain.Append("console", console)
+			chain.Append("sink", &recordingLogger{})
+
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.RemoteAddr = tt.remote
+			w := httptest.NewRecorder()
+			NewLevelAdmin(chain).ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if got := console.Level(); got != tt.wantLevel {
+				t.Errorf("console level = %s, want %s", LevelName(got), LevelName(tt.wantLevel))
+			}
+			if w.Code == http.StatusMethodNotAllowed {
+				if allow := w.Header().Get("Allow"); allow != "GET, PUT" {
+					t.Errorf("Allow = %q", allow)
+				}
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var levels map[string]string
+			if err := json.NewDecoder(w.Body).Decode(&levels); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]string{"console": LevelName(tt.wantLevel)}
+			if len(levels) != len(want) || levels["console"] != want["console"] {
+				t.Errorf("levels = %v, want %v", levels, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrLoggerClosed = errors.New("logger is closed")
+
+// OverflowPolicy decides what an AsyncLogger does when its queue is full
+type OverflowPolicy int
+
+const (
+	Block      OverflowPolicy = iota // wait until the queue has room
+	DropOldest                       // discard the oldest queued record
+	DropNewest                       // discard the incoming record
+)
+
+// ConcreteHandler that hands records to the rest of the chain on a background goroutine
+type AsyncLogger struct {
+	link
+	size    int
+	policy  OverflowPolicy
+	onError func(error)
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []Record
+	busy    bool
+	closed  bool
+	dropped uint64
+	done    chan struct{}
+}
+
+// NewAsyncLogger queues up to size records; errors from the rest of the chain
+// are passed to onError, which may be nil.
+func NewAsyncLogger(size int, policy OverflowPolicy, onError func(error)) *AsyncLogger {
+	if size < 1 {
+		size = 1
+	}
+	a := &AsyncLogger{
+		size:    size,
+		policy:  policy,
+		onError: onError,
+		queue:   make([]Record, 0, size),
+		done:    make(chan struct{}),
+	}
+	a.cond = sync.NewCond(&a.mu)
+	go a.run()
+	return a
+}
+
+// LogMessage queues the record and reports whether it was accepted
+func (a *AsyncLogger) LogMessage(r Record) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for !a.closed && len(a.queue) == a.size {
+		switch a.policy {
+		case DropNewest:
+			a.dropped++
+			return false, nil
+		case DropOldest:
+			a.queue = append(a.queue[:0], a.queue[1:]...)
+			a.dropped++
+		default:
+			a.cond.Wait()
+		}
+	}
+	if a.closed {
+		return false, ErrLoggerClosed
+	}
+	a.queue = append(a.queue, r)
+	a.cond.Broadcast()
+	return true, nil
+}
+
+func (a *AsyncLogger) run() {
+	defer close(a.done)
+	for {
+		a.mu.Lock()
+		for len(a.queue) == 0 && !a.closed {
+			a.cond.Wait()
+		}
+		if len(a.queue) == 0 {
+			a.mu.Unlock()
+			return
+		}
+		r := a.queue[0]
+		a.queue = append(a.queue[:0], a.queue[1:]...)
+		a.busy = true
+		a.cond.Broadcast()
+		a.mu.Unlock()
+
+		_, err := a.forward(r, false)
+		if err != nil && a.onError != nil {
+			a.onError(err)
+		}
+
+		a.mu.Lock()
+		a.busy = false
+		a.cond.Broadcast()
+		a.mu.Unlock()
+	}
+}
+
+// Flush waits until every queued record has been passed down the chain
+func (a *AsyncLogger) Flush() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for len(a.queue) > 0 || a.busy {
+		a.cond.Wait()
+	}
+}
+
+// Close stops accepting records and drains the queue
+func (a *AsyncLogger) Close() error {
+	a.mu.Lock()
+	a.closed = true
+	a.cond.Broadcast()
+	a.mu.Unlock()
+	<-a.done
+	return nil
+}
+
+// Dropped reports how many records were discarded because the queue was full
+func (a *AsyncLogger) Dropped() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.dropped
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var ErrLevelNotSupported = errors.New("handler has no adjustable level")
+
+// Chain is an ordered chain of named handlers. Handlers can be inserted,
+// removed and have their levels changed while other goroutines are logging.
+// A Chain is itself a Logger, so it can be linked into a larger chain or
+// passed wherever a single handler is expected.
+type Chain struct {
+	root link // root.next is the head of the chain
+
+	mu       sync.Mutex // serialises changes to the chain
+	names    []string   // handler names from head to tail
+	handlers map[string]Logger
+}
+
+func NewChain() *Chain {
+	return &Chain{handlers: make(map[string]Logger)}
+}
+
+func (c *Chain) LogMessage(r Record) (bool, error) {
+	return c.root.forward(r, false)
+}
+
+// SetNext links the tail of the chain to next. Handlers appended later are
+// inserted in front of next.
+func (c *Chain) SetNext(next Logger) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.predecessor(len(c.names)).SetNext(next)
+}
+
+// Next returns the Logger that follows the tail of the chain
+func (c *Chain) Next() Logger {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.predecessor(len(c.names)).Next()
+}
+
+// Append adds a handler to the tail of the chain
+func (c *Chain) Append(name string, h Logger) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	after := ""
+	if len(c.names) > 0 {
+		after = c.names[len(c.names)-1]
+	}
+	return c.insertAfter(after, name, h)
+}
+
+// InsertAfter adds a handler behind the named one, or at the head if after is empty
+func (c *Chain) InsertAfter(after, name string, h Logger) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.insertAfter(after, name, h)
+}
+
+func (c *Chain) insertAfter(after, name string, h Logger) error {
+	if _, ok := c.handlers[name]; ok {
+		return fmt.Errorf("%w: %q", ErrDuplicateHandler, name)
+	}
+	pos := 0
+	if after != "" {
+		i := c.index(after)
+		if i < 0 {
+			return fmt.Errorf("%w %q", ErrUnknownHandler, after)
+		}
+		pos = i + 1
+	}
+	prev := c.predecessor(pos)
+	// Link the new handler to its successor before making it reachable, so
+	// that records already travelling down the chain never hit a dead end.
+	h.SetNext(prev.Next())
+	prev.SetNext(h)
+
+	c.handlers[name] = h
+	c.names = append(c.names, "")
+	copy(c.names[pos+1:], c.names[pos:])
+	c.names[pos] = name
+	return nil
+}
+
+// Remove unlinks the named handler and returns it. Records already passing
+// through the removed handler still reach the rest of the chain.
+func (c *Chain) Remove(name string) (Logger, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.index(name)
+	if i < 0 {
+		return nil, fmt.Errorf("%w %q", ErrUnknownHandler, name)
+	}
+	h := c.handlers[name]
+	c.predecessor(i).SetNext(h.Next())
+
+	delete(c.handlers, name)
+	c.names = append(c.names[:i], c.names[i+1:]...)
+	return h, nil
+}
+
+// predecessor returns what links to the handler at position i
+func (c *Chain) predecessor(i int) interface {
+	SetNext(Logger)
+	Next() Logger
+} {
+	if i == 0 {
+		return &c.root
+	}
+	return c.handlers[c.names[i-1]]
+}
+
+func (c *Chain) index(name string) int {
+	for i, n := range c.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Handler looks up a handler by name
+func (c *Chain) Handler(name string) (Logger, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.handlers[name]
+	return h, ok
+}
+
+// Names lists the handlers from head to tail
+func (c *Chain) Names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.names...)
+}
+
+// SetLevel changes the minimum level of the named handler
+func (c *Chain) SetLevel(name string, level int) error {
+	h, ok := c.Handler(name)
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownHandler, name)
+	}
+	setter, ok := h.(LevelSetter)
+	if !ok {
+		return fmt.Errorf("%q: %w", name, ErrLevelNotSupported)
+	}
+	setter.SetLevel(level)
+	return nil
+}
+
+// Levels reports the minimum level of every handler that has one
+func (c *Chain) Levels() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	levels := make(map[string]int)
+	for name, h := range c.handlers {
+		if setter, ok := h.(LevelSetter); ok {
+			levels[name] = setter.Level()
+		}
+	}
+	return levels
+}
+
+// Close releases handlers that hold resources, such as open files. Handlers
+// are closed from head to tail so that buffering handlers can drain first.
+func (c *Chain) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for _, name := range c.names {
+		if closer, ok := c.handlers[name].(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
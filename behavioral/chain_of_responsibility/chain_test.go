@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// visitLogger notes its name in visits and passes every record on
+type visitLogger struct {
+	link
+	name   string
+	visits *[]string
+}
+
+func (l *visitLogger) LogMessage(r Record) (bool, error) {
+	*l.visits = append(*l.visits, l.name)
+	return l.forward(r, true)
+}
+
+// countingLogger counts the records it sees and passes them on; it is safe
+// for concurrent use
+type countingLogger struct {
+	link
+	n atomic.Int64
+}
+
+func (l *countingLogger) LogMessage(r Record) (bool, error) {
+	l.n.Add(1)
+	return l.forward(r, true)
+}
+
+func TestChainOrder(t *testing.T) {
+	var visits []string
+	chain := NewChain()
+	add := func(after, name string) error {
+		return chain.InsertAfter(after, name, &visitLogger{name: name, visits: &visits})
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if err := chain.Append(name, &visitLogger{name: name, visits: &visits}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := add("a", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := add("", "head"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.Remove("b"); err != nil {
+		t.Fatal(err)
+	}
+	tail := &recordingLogger{}
+	chain.SetNext(tail)
+	if err := add("c", "last"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"head", "a", "x", "c", "last"}
+	if got := chain.Names(); !slices.Equal(got, want) {
+		t.Errorf("Names() = %q, want %q", got, want)
+	}
+	if handled, err := chain.LogMessage(NewRecord(Info, "hello")); !handled || err != nil {
+		t.Fatalf("LogMessage = %v, %v", handled, err)
+	}
+	if !slices.Equal(visits, want) {
+		t.Errorf("record visited %q, want %q", visits, want)
+	}
+	if len(tail.records) != 1 {
+		t.Errorf("the Logger after the chain received %d records, want 1", len(tail.records))
+	}
+
+	if err := add("head", "a"); !errors.Is(err, ErrDuplicateHandler) {
+		t.Errorf("duplicate name: err = %v", err)
+	}
+	if err := add("nope", "y"); !errors.Is(err, ErrUnknownHandler) {
+		t.Errorf("unknown predecessor: err = %v", err)
+	}
+	if _, err := chain.Remove("b"); !errors.Is(err, ErrUnknownHandler) {
+		t.Errorf("removing twice: err = %v", err)
+	}
+}
+
+func TestChainConcurrentChanges(t *testing.T) {
+	const loggers, records, changes = 4, 2000, 300
+	chain := NewChain()
+	sink := &countingLogger{}
+	if err := chain.Append("sink", sink); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < loggers; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < records; i++ {
+				chain.LogMessage(NewRecord(Info, "record"))
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Handlers come and go in front of, behind and between each other,
+		// and have their levels changed, while records flow
+		var names []string
+		for i := 0; i < changes; i++ {
+			name := fmt.Sprint("h", i)
+			var err error
+			switch i % 3 {
+			case 0:
+				err = chain.InsertAfter("", name, NewConsoleLogger(Error+1, PassThrough))
+			case 1:
+				err = chain.Append(name, &countingLogger{})
+			case 2:
+				err = chain.InsertAfter(names[len(names)-1], name, &countingLogger{})
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			names = append(names, name)
+			if i%3 == 0 {
+				if err := chain.SetLevel(name, Error+2); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			if len(names) > 5 {
+				if _, err := chain.Remove(names[0]); err != nil {
+					t.Error(err)
+					return
+				}
+				names = names[1:]
+			}
+		}
+		for _, name := range names {
+			if _, err := chain.Remove(name); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	wg.Wait()
+
+	// No record was lost on the way to the one handler that stayed
+	if got := sink.n.Load(); got != loggers*records {
+		t.Errorf("sink received %d records, want %d", got, loggers*records)
+	}
+	if got := chain.Names(); !slices.Equal(got, []string{"sink"}) {
+		t.Errorf("Names() = %q after removing the others", got)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownHandlerType = errors.New("unknown handler type")
+	ErrUnknownHandler     = errors.New("unknown handler")
+	ErrDuplicateHandler   = errors.New("duplicate handler name")
+	ErrChainCycle         = errors.New("handler chain contains a cycle")
+	ErrUnreachableHandler = errors.New("handler is unreachable from the head of the chain")
+)
+
+// ChainConfig describes a chain of handlers linked by name
+type ChainConfig struct {
+	Head     string          `json:"head"`
+	Handlers []HandlerConfig `json:"handlers"`
+}
+
+// HandlerConfig describes a single handler in a ChainConfig
+type HandlerConfig struct {
+	Name    string          `json:"name"`
+	Type    string          `json:"type"`
+	Level   string          `json:"level"`
+	Mode    string          `json:"mode"`
+	Next    string          `json:"next"`
+	Options json.RawMessage `json:"options"`
+}
+
+// HandlerFactory creates a handler from its configuration
+type HandlerFactory func(cfg HandlerConfig, level int, mode Mode) (Logger, error)
+
+var handlerFactories = map[string]HandlerFactory{
+	"console": func(cfg HandlerConfig, level int, mode Mode) (Logger, error) {
+		return NewConsoleLogger(level, mode), nil
+	},
+	"error": func(cfg HandlerConfig, level int, mode Mode) (Logger, error) {
+		return NewErrorLogger(level, mode), nil
+	},
+	"file":     newFileLoggerFromConfig,
+	"slog":     newSlogLoggerFromConfig,
+	"async":    newAsyncLoggerFromConfig,
+	"sampling": newSamplingLoggerFromConfig,
+}
+
+// Handler types that pass every record on, so they take no level or mode
+var unleveledTypes = map[string]bool{"async": true, "sampling": true}
+
+// RegisterHandlerType makes a handler type available to ChainConfig
+func RegisterHandlerType(name string, factory HandlerFactory) {
+	handlerFactories[name] = factory
+}
+
+func newFileLoggerFromConfig(cfg HandlerConfig, level int, mode Mode) (Logger, error) {
+	var opts struct {
+		Path       string `json:"path"`
+		MaxSize    int64  `json:"max_size"`
+		MaxAge     string `json:"max_age"`
+		MaxBackups int    `json:"max_backups"`
+	}
+	if len(cfg.Options) > 0 {
+		if err := json.Unmarshal(cfg.Options, &opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Path == "" {
+		return nil, errors.New("options.path is required")
+	}
+	var maxAge time.Duration
+	if opts.MaxAge != "" {
+		var err error
+		if maxAge, err = time.ParseDuration(opts.MaxAge); err != nil {
+			return nil, err
+		}
+	}
+	return NewFileLogger(opts.Path, level, mode, FileLoggerOptions{
+		MaxSize:    opts.MaxSize,
+		MaxAge:     maxAge,
+		MaxBackups: opts.MaxBackups,
+	})
+}
+
+// newSlogLoggerFromConfig writes to a slog handler of its own rather than
+// slog.Default(), which may itself be backed by this chain
+func newSlogLoggerFromConfig(cfg HandlerConfig, level int, mode Mode) (Logger, error) {
+	var opts struct {
+		Output string `json:"output"`
+		Format string `json:"format"`
+	}
+	if len(cfg.Options) > 0 {
+		if err := json.Unmarshal(cfg.Options, &opts); err != nil {
+			return nil, err
+		}
+	}
+	outputs := map[string]io.Writer{"": os.Stderr, "stderr": os.Stderr, "stdout": os.Stdout}
+	w, ok := outputs[opts.Output]
+	if !ok {
+		return nil, fmt.Errorf("unknown output %q", opts.Output)
+	}
+	handlerOpts := &slog.HandlerOptions{Level: slog.LevelDebug} // the chain filters by level
+	var handler slog.Handler
+	switch opts.Format {
+	case "", "text":
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return nil, fmt.Errorf("unknown format %q", opts.Format)
+	}
+	return NewSlogLogger(slog.New(handler), level, mode), nil
+}
+
+func newAsyncLoggerFromConfig(cfg HandlerConfig, level int, mode Mode) (Logger, error) {
+	var opts struct {
+		Size   int    `json:"size"`
+		Policy string `json:"policy"`
+	}
+	if len(cfg.Options) > 0 {
+		if err := json.Unmarshal(cfg.Options, &opts); err != nil {
+			return nil, err
+		}
+	}
+	policies := map[string]OverflowPolicy{"": Block, "block": Block, "drop_oldest": DropOldest, "drop_newest": DropNewest}
+	policy, ok := policies[opts.Policy]
+	if !ok {
+		return nil, fmt.Errorf("unknown overflow policy %q", opts.Policy)
+	}
+	return NewAsyncLogger(opts.Size, policy, nil), nil
+}
+
+func newSamplingLoggerFromConfig(cfg HandlerConfig, level int, mode Mode) (Logger, error) {
+	var opts struct {
+		Window string `json:"window"`
+	}
+	if len(cfg.Options) > 0 {
+		if err := json.Unmarshal(cfg.Options, &opts); err != nil {
+			return nil, err
+		}
+	}
+	window, err := time.ParseDuration(opts.Window)
+	if err != nil {
+		return nil, fmt.Errorf("options.window: %w", err)
+	}
+	return NewSamplingLogger(window), nil
+}
+
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(s) {
+	case "", "pass_through", "passthrough":
+		return PassThrough, nil
+	case "terminal":
+		return Terminal, nil
+	}
+	return 0, fmt.Errorf("unknown mode %q", s)
+}
+
+// ParseChainConfig decodes a JSON chain description
+func ParseChainConfig(r io.Reader) (ChainConfig, error) {
+	var cfg ChainConfig
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return ChainConfig{}, fmt.Errorf("chain config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate reports every problem in the configuration at once
+func (c ChainConfig) Validate() error {
+	var errs []error
+	byName := make(map[string]HandlerConfig, len(c.Handlers))
+	for _, h := range c.Handlers {
+		if h.Name == "" {
+			errs = append(errs, errors.New("handler without a name"))
+			continue
+		}
+		if _, ok := byName[h.Name]; ok {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrDuplicateHandler, h.Name))
+			continue
+		}
+		byName[h.Name] = h
+		if _, ok := handlerFactories[h.Type]; !ok {
+			errs = append(errs, fmt.Errorf("handler %q: %w %q", h.Name, ErrUnknownHandlerType, h.Type))
+		}
+		if unleveledTypes[h.Type] {
+			if h.Level != "" || h.Mode != "" {
+				errs = append(errs, fmt.Errorf("handler %q: %s handlers take no level or mode", h.Name, h.Type))
+			}
+			continue
+		}
+		if _, err := ParseLevel(h.Level); err != nil {
+			errs = append(errs, fmt.Errorf("handler %q: %w", h.Name, err))
+		}
+		if _, err := ParseMode(h.Mode); err != nil {
+			errs = append(errs, fmt.Errorf("handler %q: %w", h.Name, err))
+		}
+	}
+	for _, h := range c.Handlers {
+		if _, ok := byName[h.Next]; h.Next != "" && !ok {
+			errs = append(errs, fmt.Errorf("handler %q: next: %w %q", h.Name, ErrUnknownHandler, h.Next))
+		}
+	}
+	if _, ok := byName[c.Head]; !ok {
+		errs = append(errs, fmt.Errorf("head: %w %q", ErrUnknownHandler, c.Head))
+		return errors.Join(errs...)
+	}
+
+	// Every handler has at most one successor, so following next from each
+	// handler either ends the chain or runs into a handler already on the path.
+	checked := make(map[string]bool, len(byName))
+	for _, h := range c.Handlers {
+		path := map[string]bool{}
+		for name := h.Name; name != "" && !checked[name]; name = byName[name].Next {
+			if path[name] {
+				errs = append(errs, fmt.Errorf("%w through %q", ErrChainCycle, name))
+				break
+			}
+			path[name] = true
+		}
+		for name := range path {
+			checked[name] = true
+		}
+	}
+
+	reachable := map[string]bool{}
+	for name := c.Head; name != "" && !reachable[name]; name = byName[name].Next {
+		reachable[name] = true
+	}
+	for _, h := range c.Handlers {
+		if h.Name != "" && !reachable[h.Name] {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrUnreachableHandler, h.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Build validates the configuration and links the handlers together
+func (c ChainConfig) Build() (*Chain, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	handlers := make(map[string]Logger, len(c.Handlers))
+	for _, h := range c.Handlers {
+		// Validate has already checked level and mode; unleveled types ignore them
+		level, _ := ParseLevel(h.Level)
+		mode, _ := ParseMode(h.Mode)
+		handler, err := handlerFactories[h.Type](h, level, mode)
+		if err != nil {
+			for _, created := range handlers {
+				if closer, ok := created.(io.Closer); ok {
+					closer.Close()
+				}
+			}
+			return nil, fmt.Errorf("handler %q: %w", h.Name, err)
+		}
+		handlers[h.Name] = handler
+	}
+	byName := make(map[string]HandlerConfig, len(c.Handlers))
+	for _, h := range c.Handlers {
+		byName[h.Name] = h
+	}
+	// Validate has already ruled out cycles, duplicates and unreachable handlers
+	chain := NewChain()
+	for name := c.Head; name != ""; name = byName[name].Next {
+		chain.Append(name, handlers[name])
+	}
+	return chain, nil
+}
+
+// BuildChain reads a JSON chain description and builds it
+func BuildChain(r io.Reader) (*Chain, error) {
+	cfg, err := ParseChainConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Build()
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileLoggerOptions controls when a FileLogger rotates its file
+type FileLoggerOptions struct {
+	MaxSize    int64         // rotate before the file grows past this many bytes, 0 disables
+	MaxAge     time.Duration // rotate once the file's first record is this old, 0 disables
+	MaxBackups int           // number of compressed backups to keep, 0 keeps none
+}
+
+// ConcreteHandler writing JSON lines to a rotating file
+type FileLogger struct {
+	link
+	levelFilter
+	path string
+	opts FileLoggerOptions
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	closed bool
+}
+
+func NewFileLogger(path string, level int, mode Mode, opts FileLoggerOptions) (*FileLogger, error) {
+	f := &FileLogger{link: link{mode: mode}, path: path, opts: opts}
+	f.SetLevel(level)
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// jsonRecord is the on-disk shape of a Record
+type jsonRecord struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+func (f *FileLogger) LogMessage(r Record) (bool, error) {
+	if !f.enabled(r.Level) {
+		return f.forward(r, false)
+	}
+	// A record that cannot be written still goes to the rest of the chain, and
+	// one that was written counts as handled even if rotation failed
+	written := false
+	line, err := encodeJSONLine(r)
+	if err == nil {
+		written, err = f.write(line, r.Level >= Error)
+	}
+	handled, forwardErr := f.forward(r, written)
+	return handled, errors.Join(err, forwardErr)
+}
+
+func encodeJSONLine(r Record) ([]byte, error) {
+	jr := jsonRecord{Time: r.Time, Level: LevelName(r.Level), Message: r.Message}
+	if len(r.Fields) > 0 {
+		jr.Fields = make(map[string]interface{}, len(r.Fields))
+		for _, field := range r.Fields {
+			jr.Fields[field.Key] = field.Value
+		}
+	}
+	line, err := json.Marshal(jr)
+	if err != nil {
+		return nil, fmt.Errorf("file logger: encode record: %w", err)
+	}
+	return append(line, '\n'), nil
+}
+
+// write appends line to the file and reports whether it was written. A failed
+// rotation leaves a file open whenever it can, so the line is still written
+// and rotation is tried again on the next write.
+func (f *FileLogger) write(line []byte, flush bool) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return false, fmt.Errorf("file logger: %s is closed", f.path)
+	}
+	if f.file == nil {
+		// An earlier rotation could not reopen the file
+		if err := f.open(); err != nil {
+			return false, err
+		}
+	}
+	var rotateErr error
+	if f.needsRotation(int64(len(line))) {
+		if rotateErr = f.rotate(); f.file == nil {
+			return false, rotateErr
+		}
+	}
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	if err != nil {
+		return false, errors.Join(rotateErr, fmt.Errorf("file logger: write: %w", err))
+	}
+	if flush {
+		if err := f.file.Sync(); err != nil {
+			return true, errors.Join(rotateErr, fmt.Errorf("file logger: sync: %w", err))
+		}
+	}
+	return true, rotateErr
+}
+
+func (f *FileLogger) needsRotation(next int64) bool {
+	if f.opts.MaxSize > 0 && f.size > 0 && f.size+next > f.opts.MaxSize {
+		return true
+	}
+	return f.opts.MaxAge > 0 && time.Since(f.opened) >= f.opts.MaxAge
+}
+
+func (f *FileLogger) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("file logger: open: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("file logger: stat: %w", err)
+	}
+	f.file, f.size, f.opened = file, info.Size(), created(f.path, info)
+	return nil
+}
+
+// created returns when the file at path was started. Appending to an existing
+// file keeps its age, so that MaxAge is not reset every time the process
+// restarts: the age is taken from the first record in the file, or from the
+// modification time if that cannot be read.
+func created(path string, info os.FileInfo) time.Time {
+	if info.Size() == 0 {
+		return time.Now()
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return info.ModTime()
+	}
+	defer file.Close()
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil {
+		return info.ModTime()
+	}
+	var first jsonRecord
+	if err := json.Unmarshal(line, &first); err != nil || first.Time.IsZero() {
+		return info.ModTime()
+	}
+	return first.Time
+}
+
+// rotate moves the current file aside as a compressed backup and starts a new
+// one. If the file cannot be moved or replaced, the current file is reopened.
+func (f *FileLogger) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return f.reopen(fmt.Errorf("file logger: close: %w", err))
+	}
+
+	backup := f.path + "." + time.Now().Format("20060102T150405.000000000")
+	if err := os.Rename(f.path, backup); err != nil {
+		return f.reopen(fmt.Errorf("file logger: rotate: %w", err))
+	}
+	if err := f.open(); err != nil {
+		if renameErr := os.Rename(backup, f.path); renameErr != nil {
+			return errors.Join(err, fmt.Errorf("file logger: restore: %w", renameErr))
+		}
+		return f.reopen(err)
+	}
+	if f.opts.MaxBackups <= 0 {
+		return os.Remove(backup)
+	}
+	if err := compressFile(backup); err != nil {
+		return err
+	}
+	return f.pruneBackups()
+}
+
+// reopen opens the current file again after a failed rotation and returns
+// the error that caused it
+func (f *FileLogger) reopen(cause error) error {
+	if err := f.open(); err != nil {
+		return errors.Join(cause, err)
+	}
+	return cause
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("file logger: compress: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("file logger: compress: %w", err)
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("file logger: compress: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return fmt.Errorf("file logger: compress: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("file logger: compress: %w", err)
+	}
+	return os.Remove(path)
+}
+
+// pruneBackups removes the oldest backups beyond MaxBackups
+func (f *FileLogger) pruneBackups() error {
+	backups, err := filepath.Glob(f.path + ".*.gz")
+	if err != nil {
+		return fmt.Errorf("file logger: prune: %w", err)
+	}
+	// The timestamp suffix sorts chronologically
+	sort.Strings(backups)
+	for len(backups) > f.opts.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("file logger: prune: %w", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+func (f *FileLogger) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
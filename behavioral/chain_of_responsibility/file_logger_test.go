@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestFileLogger(t *testing.T, mode Mode, opts FileLoggerOptions) *FileLogger {
+	t.Helper()
+	f, err := NewFileLogger(filepath.Join(t.TempDir(), "app.log"), Info, mode, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func logMessages(t *testing.T, f *FileLogger, messages ...string) {
+	t.Helper()
+	for _, message := range messages {
+		if _, err := f.LogMessage(NewRecord(Warning, message)); err != nil {
+			t.Fatalf("log %q: %v", message, err)
+		}
+	}
+}
+
+// backups lists the compressed backups of the log at path, oldest first
+func backups(t *testing.T, path string) []string {
+	t.Helper()
+	names, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".gz") {
+			t.Errorf("uncompressed backup %s", name)
+		}
+	}
+	return names
+}
+
+// readMessages returns the messages of the JSON lines in path, which may be
+// gzip-compressed
+func readMessages(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		r = zr
+	}
+	var messages []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var jr jsonRecord
+		if err := json.Unmarshal(scanner.Bytes(), &jr); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		messages = append(messages, jr.Message)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return messages
+}
+
+// allMessages returns the messages of every backup and then of the current file
+func allMessages(t *testing.T, path string) []string {
+	t.Helper()
+	var messages []string
+	for _, backup := range backups(t, path) {
+		messages = append(messages, readMessages(t, backup)...)
+	}
+	return append(messages, readMessages(t, path)...)
+}
+
+func numbered(n int) []string {
+	messages := make([]string, n)
+	for i := range messages {
+		messages[i] = fmt.Sprintf("message %02d", i)
+	}
+	return messages
+}
+
+func TestFileLoggerRotatesBySize(t *testing.T) {
+	const maxSize = 300
+	f := newTestFileLogger(t, PassThrough, FileLoggerOptions{MaxSize: maxSize, MaxBackups: 100})
+	messages := numbered(20)
+	for _, message := range messages {
+		logMessages(t, f, message)
+		info, err := os.Stat(f.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > maxSize {
+			t.Fatalf("after %q the file holds %d bytes, more than %d", message, info.Size(), maxSize)
+		}
+	}
+	if len(backups(t, f.path)) < 2 {
+		t.Fatalf("%d backups, want several", len(backups(t, f.path)))
+	}
+	// Compressing the backups loses and reorders nothing
+	if got := allMessages(t, f.path); !slices.Equal(got, messages) {
+		t.Errorf("messages = %q, want %q", got, messages)
+	}
+}
+
+func TestFileLoggerRotatesByAge(t *testing.T) {
+	tests := []struct {
+		name        string
+		firstRecord time.Duration // age of the record already in the file
+		wantBackups int
+	}{
+		{"young file", time.Minute, 0},
+		{"old file", 2 * time.Hour, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The age comes from the file's first record, so that a restart
+			// does not reset it
+			path := filepath.Join(t.TempDir(), "app.log")
+			old := NewRecord(Warning, "before restart")
+			old.Time = time.Now().Add(-tt.firstRecord)
+			line, err := encodeJSONLine(old)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, line, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := NewFileLogger(path, Info, PassThrough, FileLoggerOptions{MaxAge: time.Hour, MaxBackups: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			logMessages(t, f, "after restart")
+
+			if got := len(backups(t, path)); got != tt.wantBackups {
+				t.Fatalf("%d backups, want %d", got, tt.wantBackups)
+			}
+			want := []string{"before restart", "after restart"}
+			if got := allMessages(t, path); !slices.Equal(got, want) {
+				t.Errorf("messages = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestFileLoggerPrunesBackups(t *testing.T) {
+	tests := []struct {
+		maxBackups  int
+		wantBackups [][]string
+	}{
+		{0, nil},
+		{2, [][]string{{"message 02"}, {"message 03"}}},
+		{10, [][]string{{"message 00"}, {"message 01"}, {"message 02"}, {"message 03"}}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("MaxBackups=%d", tt.maxBackups), func(t *testing.T) {
+			// Every record after the first rotates the file
+			f := newTestFileLogger(t, PassThrough, FileLoggerOptions{MaxSize: 1, MaxBackups: tt.maxBackups})
+			logMessages(t, f, numbered(5)...)
+
+			var got [][]string
+			for _, backup := range backups(t, f.path) {
+				got = append(got, readMessages(t, backup))
+			}
+			if !slices.EqualFunc(got, tt.wantBackups, slices.Equal[[]string]) {
+				t.Errorf("backups hold %q, want %q", got, tt.wantBackups)
+			}
+			if got, want := readMessages(t, f.path), []string{"message 04"}; !slices.Equal(got, want) {
+				t.Errorf("current file holds %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestFileLoggerFailedRename(t *testing.T) {
+	f := newTestFileLogger(t, Terminal, FileLoggerOptions{MaxSize: 1, MaxBackups: 1})
+	next := &recordingLogger{}
+	f.SetNext(next)
+	logMessages(t, f, "first")
+
+	// Renaming a file that has been removed fails, so the rotation before the
+	// next record fails too
+	if err := os.Remove(f.path); err != nil {
+		t.Fatal(err)
+	}
+	handled, err := f.LogMessage(NewRecord(Warning, "second"))
+	if err == nil || !strings.Contains(err.Error(), "rotate") {
+		t.Errorf("err = %v, want the rename error", err)
+	}
+	// The line was still written to a reopened file, so the terminal handler
+	// consumed it
+	if !handled {
+		t.Error("record reported as not handled")
+	}
+	if len(next.records) != 0 {
+		t.Errorf("terminal handler forwarded %d records", len(next.records))
+	}
+	if got, want := readMessages(t, f.path), []string{"second"}; !slices.Equal(got, want) {
+		t.Errorf("file holds %q, want %q", got, want)
+	}
+
+	// The next rotation works again
+	logMessages(t, f, "third")
+	if got, want := allMessages(t, f.path), []string{"second", "third"}; !slices.Equal(got, want) {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+}
+
+func TestFileLoggerForwardsWhenWriteFails(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(f *FileLogger)
+	}{
+		{"write error", func(f *FileLogger) { f.file.Close() }},
+		{"closed logger", func(f *FileLogger) { f.Close() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Even a terminal handler passes on a record it could not write
+			f := newTestFileLogger(t, Terminal, FileLoggerOptions{})
+			next := &recordingLogger{}
+			f.SetNext(next)
+			tt.fail(f)
+
+			handled, err := f.LogMessage(NewRecord(Error, "disk full"))
+			if err == nil {
+				t.Error("no error")
+			}
+			if !handled {
+				t.Error("record reported as not handled, but the next handler took it")
+			}
+			if len(next.records) != 1 || next.records[0].Message != "disk full" {
+				t.Errorf("next handler received %v", next.records)
+			}
+		})
+	}
+}
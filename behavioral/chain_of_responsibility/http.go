@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RequestHandler is the Handler interface of the HTTP chain. A handler either
+// writes a response and stops, or passes the request to the next handler.
+type RequestHandler interface {
+	SetNext(RequestHandler)
+	Handle(http.ResponseWriter, *http.Request)
+}
+
+// requestLink holds the state every HTTP ConcreteHandler needs to take part in the chain
+type requestLink struct {
+	next RequestHandler
+}
+
+func (l *requestLink) SetNext(next RequestHandler) {
+	l.next = next
+}
+
+func (l *requestLink) pass(w http.ResponseWriter, r *http.Request) {
+	if l.next == nil {
+		http.NotFound(w, r)
+		return
+	}
+	l.next.Handle(w, r)
+}
+
+// AsHTTPHandler lets net/http serve requests through the chain starting at head
+func AsHTTPHandler(head RequestHandler) http.Handler {
+	return http.HandlerFunc(head.Handle)
+}
+
+// ConcreteHandler turning panics further down the chain into 500 responses
+type RecoveryHandler struct {
+	requestLink
+	logger Logger
+}
+
+// NewRecoveryHandler reports recovered panics to logger, which may be nil
+func NewRecoveryHandler(logger Logger) *RecoveryHandler {
+	return &RecoveryHandler{logger: logger}
+}
+
+func (h *RecoveryHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if v := recover(); v != nil {
+			if v == http.ErrAbortHandler {
+				// net/http aborts the response quietly on this panic
+				panic(v)
+			}
+			if h.logger != nil {
+				h.logger.LogMessage(NewRecord(Error, "Recovered from panic.",
+					Field{"panic", fmt.Sprint(v)},
+					Field{"path", r.URL.Path},
+					Field{"request_id", RequestIDFromContext(r.Context())}))
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	}()
+	h.pass(w, r)
+}
+
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID assigned by RequestIDHandler, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ConcreteHandler giving every request an ID, reusing the one sent by the client
+type RequestIDHandler struct {
+	requestLink
+}
+
+func NewRequestIDHandler() *RequestIDHandler {
+	return &RequestIDHandler{}
+}
+
+func (h *RequestIDHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" {
+		id = newRequestID()
+	}
+	w.Header().Set(RequestIDHeader, id)
+	h.pass(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ConcreteHandler rejecting requests without a valid bearer token
+type AuthHandler struct {
+	requestLink
+	validate func(token string) bool
+}
+
+func NewAuthHandler(validate func(token string) bool) *AuthHandler {
+	return &AuthHandler{validate: validate}
+}
+
+func (h *AuthHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !h.validate(token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	h.pass(w, r)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// ConcreteHandler limiting each client to a steady rate with short bursts.
+// Buckets of clients that have been idle long enough to refill completely are
+// forgotten, so memory stays bounded by the number of recently active clients.
+type RateLimitHandler struct {
+	requestLink
+	rate  float64 // tokens added per second
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewRateLimitHandler(perSecond float64, burst int) *RateLimitHandler {
+	return &RateLimitHandler{rate: perSecond, burst: float64(burst), buckets: make(map[string]*bucket)}
+}
+
+func (h *RateLimitHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if wait, ok := h.allow(clientAddr(r), time.Now()); !ok {
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		}
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return
+	}
+	h.pass(w, r)
+}
+
+// allow takes a token from the client's bucket or reports how long until one
+// is available, which is 0 if the bucket never refills
+func (h *RateLimitHandler) allow(client string, now time.Time) (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// A full bucket is the same as no bucket. Sweeping once per refill time
+	// keeps the cost per request constant on average.
+	if refill := h.refillTime(); refill > 0 && now.Sub(h.lastSweep) >= refill {
+		for c, b := range h.buckets {
+			if now.Sub(b.last) >= refill {
+				delete(h.buckets, c)
+			}
+		}
+		h.lastSweep = now
+	}
+
+	b, ok := h.buckets[client]
+	if !ok {
+		b = &bucket{tokens: h.burst, last: now}
+		h.buckets[client] = b
+	}
+	b.tokens = math.Min(h.burst, b.tokens+now.Sub(b.last).Seconds()*h.rate)
+	b.last = now
+	if b.tokens < 1 {
+		if h.rate <= 0 {
+			return 0, false
+		}
+		return time.Duration((1 - b.tokens) / h.rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// refillTime is how long an empty bucket takes to fill up, or 0 if it never does
+func (h *RateLimitHandler) refillTime() time.Duration {
+	if h.rate <= 0 {
+		return 0
+	}
+	return time.Duration(h.burst / h.rate * float64(time.Second))
+}
+
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ConcreteHandler at the end of the chain serving the request itself
+type EndpointHandler struct {
+	requestLink
+	handler http.Handler
+}
+
+func NewEndpointHandler(handler http.Handler) *EndpointHandler {
+	return &EndpointHandler{handler: handler}
+}
+
+func (h *EndpointHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// recordingLogger is a Logger that keeps every record it receives
+type recordingLogger struct {
+	link
+	records []Record
+}
+
+func (l *recordingLogger) LogMessage(r Record) (bool, error) {
+	l.records = append(l.records, r)
+	return true, nil
+}
+
+func (l *recordingLogger) field(i int, key string) interface{} {
+	for _, f := range l.records[i].Fields {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+// okHandler ends a chain with a 200 response naming the request ID
+func okHandler() *EndpointHandler {
+	return NewEndpointHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(RequestIDFromContext(r.Context())))
+	}))
+}
+
+func serve(head RequestHandler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	AsHTTPHandler(head).ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		wantCode      int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer guess", http.StatusUnauthorized},
+		{"wrong scheme", "Basic secret", http.StatusUnauthorized},
+		{"empty bearer", "Bearer ", http.StatusUnauthorized},
+		{"valid token", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := NewAuthHandler(func(token string) bool { return token == "secret" })
+			auth.SetNext(okHandler())
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := serve(auth, r)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			challenge := w.Header().Get("WWW-Authenticate")
+			if tt.wantCode == http.StatusUnauthorized && challenge != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want %q", challenge, "Bearer")
+			}
+			if tt.wantCode == http.StatusOK && challenge != "" {
+				t.Errorf("WWW-Authenticate = %q on success", challenge)
+			}
+		})
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		rate           float64
+		clients        []string // one request per entry, in order
+		wantCodes      []int
+		wantRetryAfter string // on the last response
+	}{
+		{
+			name:      "within burst",
+			rate:      1,
+			clients:   []string{"10.0.0.1:1000", "10.0.0.1:1001", "10.0.0.1:1002"},
+			wantCodes: []int{200, 200, 200},
+		},
+		{
+			name:           "burst exhausted",
+			rate:           1,
+			clients:        []string{"10.0.0.1:1000", "10.0.0.1:1001", "10.0.0.1:1002", "10.0.0.1:1003"},
+			wantCodes:      []int{200, 200, 200, 429},
+			wantRetryAfter: "1",
+		},
+		{
+			name:      "clients are limited separately",
+			rate:      1,
+			clients:   []string{"10.0.0.1:1000", "10.0.0.1:1001", "10.0.0.1:1002", "10.0.0.2:1000"},
+			wantCodes: []int{200, 200, 200, 200},
+		},
+		{
+			// A bucket that never refills has no time to retry after
+			name:      "no refill",
+			rate:      0,
+			clients:   []string{"10.0.0.1:1000", "10.0.0.1:1001", "10.0.0.1:1002", "10.0.0.1:1003"},
+			wantCodes: []int{200, 200, 200, 429},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := NewRateLimitHandler(tt.rate, 3)
+			limit.SetNext(okHandler())
+			var w *httptest.ResponseRecorder
+			for i, client := range tt.clients {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.RemoteAddr = client
+				w = serve(limit, r)
+				if w.Code != tt.wantCodes[i] {
+					t.Fatalf("request %d from %s: status = %d, want %d", i, client, w.Code, tt.wantCodes[i])
+				}
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestRateLimitHandlerForgetsIdleClients(t *testing.T) {
+	limit := NewRateLimitHandler(2, 4) // refills in 2s
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		limit.allow(fmt.Sprintf("10.0.0.%d", i), start)
+	}
+	if len(limit.buckets) != 100 {
+		t.Fatalf("%d buckets, want 100", len(limit.buckets))
+	}
+	if _, ok := limit.allow("late", start.Add(time.Second)); !ok {
+		t.Fatal("new client refused")
+	}
+	if len(limit.buckets) != 101 {
+		t.Fatalf("%d buckets before the refill time, want 101", len(limit.buckets))
+	}
+	if _, ok := limit.allow("later", start.Add(2*time.Second)); !ok {
+		t.Fatal("new client refused")
+	}
+	// Only "late" may still be partly empty
+	if len(limit.buckets) != 2 {
+		t.Fatalf("%d buckets after the refill time, want 2", len(limit.buckets))
+	}
+}
+
+func TestRequestIDHandler(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{16}$`)
+	tests := []struct {
+		name   string
+		sent   string
+		reused bool
+	}{
+		{"reuses the client's ID", "abc-123", true},
+		{"generates a missing ID", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestID := NewRequestIDHandler()
+			requestID.SetNext(okHandler())
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.sent != "" {
+				r.Header.Set(RequestIDHeader, tt.sent)
+			}
+			w := serve(requestID, r)
+			id := w.Header().Get(RequestIDHeader)
+			if body := w.Body.String(); body != id {
+				t.Errorf("context ID %q differs from header %q", body, id)
+			}
+			switch {
+			case tt.reused && id != tt.sent:
+				t.Errorf("ID = %q, want %q", id, tt.sent)
+			case !tt.reused && !generated.MatchString(id):
+				t.Errorf("generated ID %q is not 16 hex digits", id)
+			}
+		})
+	}
+
+	requestID := NewRequestIDHandler()
+	requestID.SetNext(okHandler())
+	first := serve(requestID, httptest.NewRequest(http.MethodGet, "/", nil)).Header().Get(RequestIDHeader)
+	second := serve(requestID, httptest.NewRequest(http.MethodGet, "/", nil)).Header().Get(RequestIDHeader)
+	if first == second {
+		t.Errorf("two requests got the same generated ID %q", first)
+	}
+}
+
+func TestRecoveryHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		wantCode  int
+		wantPanic interface{} // logged value, nil if nothing is logged
+	}{
+		{"no panic", "/ok", http.StatusOK, nil},
+		{"panic", "/panic", http.StatusInternalServerError, "something went wrong"},
+		{"panic with error", "/error", http.StatusInternalServerError, "boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &recordingLogger{}
+			requestID := NewRequestIDHandler()
+			recovery := NewRecoveryHandler(logger)
+			requestID.SetNext(recovery)
+			recovery.SetNext(NewEndpointHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/panic":
+					panic("something went wrong")
+				case "/error":
+					panic(errString("boom"))
+				}
+				w.Write([]byte("ok"))
+			})))
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set(RequestIDHeader, "req-1")
+			w := serve(requestID, r)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if tt.wantPanic == nil {
+				if len(logger.records) != 0 {
+					t.Fatalf("logged %v without a panic", logger.records)
+				}
+				return
+			}
+			if len(logger.records) != 1 {
+				t.Fatalf("logged %d records, want 1", len(logger.records))
+			}
+			if level := logger.records[0].Level; level != Error {
+				t.Errorf("level = %s, want ERROR", LevelName(level))
+			}
+			for key, want := range map[string]interface{}{"panic": tt.wantPanic, "path": tt.path, "request_id": "req-1"} {
+				if got := logger.field(0, key); got != want {
+					t.Errorf("field %s = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+type errString string
+
+func (e errString) Error() string { return string(e) }
+
+func TestRecoveryHandlerRepanicsAbort(t *testing.T) {
+	logger := &recordingLogger{}
+	recovery := NewRecoveryHandler(logger)
+	recovery.SetNext(NewEndpointHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	})))
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", v)
+		}
+		if len(logger.records) != 0 {
+			t.Errorf("logged %v for an aborted request", logger.records)
+		}
+	}()
+	serve(recovery, httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestChainWithoutEndpoint(t *testing.T) {
+	w := serve(NewRequestIDHandler(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -1,6 +1,16 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
 
 // Log levels
 const (
@@ -9,58 +19,297 @@ const (
 	Error
 )
 
+func LevelName(level int) string {
+	switch level {
+	case Info:
+		return "INFO"
+	case Warning:
+		return "WARNING"
+	case Error:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", level)
+}
+
+func ParseLevel(s string) (int, error) {
+	for _, level := range []int{Info, Warning, Error} {
+		if strings.EqualFold(s, LevelName(level)) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown level %q", s)
+}
+
+// Field is a key/value pair attached to a log record
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Record is the request passed along the chain
+type Record struct {
+	Level   int
+	Message string
+	Time    time.Time
+	Fields  []Field
+}
+
+func NewRecord(level int, message string, fields ...Field) Record {
+	return Record{Level: level, Message: message, Time: time.Now(), Fields: fields}
+}
+
+// String renders the message followed by its fields as key=value pairs
+func (r Record) String() string {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	for _, f := range r.Fields {
+		fmt.Fprintf(&b, " %s=%v", f.Key, f.Value)
+	}
+	return b.String()
+}
+
+// Mode decides what a handler does with a record it has handled
+type Mode int
+
+const (
+	PassThrough Mode = iota // handle the record and pass it to the next handler
+	Terminal                // handle the record and stop the chain
+)
+
 // Handler interface
 type Logger interface {
 	SetNext(Logger)
-	LogMessage(int, string)
+	Next() Logger
+	// LogMessage reports whether any handler in the chain handled the record.
+	LogMessage(Record) (bool, error)
+}
+
+// LevelSetter is implemented by handlers whose minimum level can change at runtime
+type LevelSetter interface {
+	Level() int
+	SetLevel(int)
+}
+
+// link holds the state every ConcreteHandler needs to take part in the chain.
+// The next handler can be replaced while other goroutines are logging.
+type link struct {
+	next atomic.Pointer[Logger]
+	mode Mode
+}
+
+func (l *link) SetNext(next Logger) {
+	if next == nil {
+		l.next.Store(nil)
+		return
+	}
+	l.next.Store(&next)
+}
+
+func (l *link) Next() Logger {
+	if next := l.next.Load(); next != nil {
+		return *next
+	}
+	return nil
+}
+
+// forward passes the record on unless a terminal handler has consumed it
+func (l *link) forward(r Record, handled bool) (bool, error) {
+	if handled && l.mode == Terminal {
+		return true, nil
+	}
+	next := l.Next()
+	if next == nil {
+		return handled, nil
+	}
+	nextHandled, err := next.LogMessage(r)
+	return handled || nextHandled, err
+}
+
+// levelFilter holds a handler's minimum level
+type levelFilter struct {
+	level atomic.Int64
+}
+
+func (f *levelFilter) Level() int {
+	return int(f.level.Load())
+}
+
+func (f *levelFilter) SetLevel(level int) {
+	f.level.Store(int64(level))
+}
+
+func (f *levelFilter) enabled(level int) bool {
+	return level >= f.Level()
 }
 
 // ConcreteHandler
 type ConsoleLogger struct {
-	level int
-	next  Logger
+	link
+	levelFilter
 }
 
-func (c *ConsoleLogger) SetNext(next Logger) {
-	c.next = next
+func NewConsoleLogger(level int, mode Mode) *ConsoleLogger {
+	c := &ConsoleLogger{link: link{mode: mode}}
+	c.SetLevel(level)
+	return c
 }
 
-func (c *ConsoleLogger) LogMessage(level int, message string) {
-	if c.level <= level {
-		fmt.Printf("Writing to console: %s\n", message)
+func (c *ConsoleLogger) LogMessage(r Record) (bool, error) {
+	if !c.enabled(r.Level) {
+		return c.forward(r, false)
 	}
-	if c.next != nil {
-		c.next.LogMessage(level, message)
+	if _, err := fmt.Printf("Writing to console: %s\n", r); err != nil {
+		return false, err
 	}
+	return c.forward(r, true)
 }
 
 // Another ConcreteHandler
 type ErrorLogger struct {
-	level int
-	next  Logger
+	link
+	levelFilter
 }
 
-func (e *ErrorLogger) SetNext(next Logger) {
-	e.next = next
+func NewErrorLogger(level int, mode Mode) *ErrorLogger {
+	e := &ErrorLogger{link: link{mode: mode}}
+	e.SetLevel(level)
+	return e
 }
 
-func (e *ErrorLogger) LogMessage(level int, message string) {
-	if e.level <= level {
-		fmt.Printf("Writing to error log: %s\n", message)
+func (e *ErrorLogger) LogMessage(r Record) (bool, error) {
+	if !e.enabled(r.Level) {
+		return e.forward(r, false)
 	}
-	if e.next != nil {
-		e.next.LogMessage(level, message)
+	if _, err := fmt.Printf("Writing to error log: %s\n", r); err != nil {
+		return false, err
 	}
+	return e.forward(r, true)
 }
 
 func main() {
-	// Setting up the chain
-	consoleLogger := &ConsoleLogger{level: Info}
-	errorLogger := &ErrorLogger{level: Error}
+	// Setting up the chain: errors stop at the error log, everything else reaches the console
+	errorLogger := NewErrorLogger(Error, Terminal)
+	consoleLogger := NewConsoleLogger(Info, PassThrough)
 
-	consoleLogger.SetNext(errorLogger)
+	errorLogger.SetNext(consoleLogger)
 
 	// Making requests
-	consoleLogger.LogMessage(Info, "This is an informational message.")
-	consoleLogger.LogMessage(Error, "This is an error message.")
+	errorLogger.LogMessage(NewRecord(Info, "This is an informational message."))
+	errorLogger.LogMessage(NewRecord(Error, "This is an error message.", Field{"code", 500}))
+
+	// Persisting warnings and errors as JSON lines next to the console output
+	dir, err := os.MkdirTemp("", "chain")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	fileLogger, err := NewFileLogger(path, Warning, PassThrough, FileLoggerOptions{MaxSize: 1 << 20, MaxBackups: 3})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fileLogger.SetNext(consoleLogger)
+
+	fileLogger.LogMessage(NewRecord(Warning, "Disk almost full.", Field{"free", "3%"}))
+	fileLogger.Close()
+
+	contents, _ := os.ReadFile(path)
+	fmt.Printf("File contents: %s", contents)
+
+	// Assembling the same kind of chain from configuration instead of code
+	chain, err := BuildChain(strings.NewReader(`{
+		"head": "errors",
+		"handlers": [
+			{"name": "errors", "type": "error", "level": "error", "mode": "terminal", "next": "console"},
+			{"name": "console", "type": "console", "level": "info"}
+		]
+	}`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer chain.Close()
+
+	chain.LogMessage(NewRecord(Error, "This error was routed by configuration."))
+
+	// Changing the running chain: raise the console level through the admin
+	// endpoint, then take the error log out so errors reach the console
+	admin := NewLevelAdmin(chain)
+	req := httptest.NewRequest(http.MethodPut, "http://127.0.0.1:6060/levels?handler=console&level=warning", nil)
+	req.RemoteAddr = "127.0.0.1:50000"
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, req)
+	fmt.Printf("Levels: %s", rec.Body)
+
+	chain.LogMessage(NewRecord(Info, "This message is now below the console level."))
+	chain.Remove("errors")
+	chain.LogMessage(NewRecord(Error, "This error skipped the removed error log."))
+
+	// Mistakes in the configuration are reported together
+	_, err = BuildChain(strings.NewReader(`{
+		"head": "a",
+		"handlers": [
+			{"name": "a", "type": "console", "level": "info", "next": "b"},
+			{"name": "b", "type": "syslog", "level": "info", "next": "a"},
+			{"name": "c", "type": "console", "level": "info"}
+		]
+	}`))
+	fmt.Println(err)
+
+	// Using the chain as the backend of a slog.Logger
+	logger := slog.New(NewSlogHandler(consoleLogger, Info)).With("service", "billing")
+	logger.WithGroup("request").Info("Request served.", "status", 200)
+
+	// Forwarding chain records into an existing slog.Logger
+	slogLogger := NewSlogLogger(slog.New(slog.NewTextHandler(os.Stdout, nil)), Warning, Terminal)
+	slogLogger.LogMessage(NewRecord(Warning, "Forwarded to slog.", Field{"attempt", 2}))
+
+	// Keeping console writes off the hot path and collapsing repeated messages
+	sampler := NewSamplingLogger(time.Minute)
+	asyncLogger := NewAsyncLogger(128, DropOldest, func(err error) { fmt.Println(err) })
+	sampler.SetNext(asyncLogger)
+	asyncLogger.SetNext(consoleLogger)
+
+	for i := 0; i < 5; i++ {
+		sampler.LogMessage(NewRecord(Warning, "Cache miss."))
+	}
+	sampler.Flush()
+	asyncLogger.Close()
+
+	// Applying the same pattern to HTTP request processing
+	requestID := NewRequestIDHandler()
+	recovery := NewRecoveryHandler(chain) // a Chain is a Logger like any single handler
+	rateLimit := NewRateLimitHandler(1, 3)
+	auth := NewAuthHandler(func(token string) bool { return token == "secret" })
+	endpoint := NewEndpointHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("something went wrong")
+		}
+		fmt.Fprintf(w, "Hello, request %s!", RequestIDFromContext(r.Context()))
+	}))
+
+	requestID.SetNext(recovery)
+	recovery.SetNext(rateLimit)
+	rateLimit.SetNext(auth)
+	auth.SetNext(endpoint)
+
+	server := AsHTTPHandler(requestID)
+	for _, req := range []struct{ path, token string }{
+		{"/hello", ""},
+		{"/hello", "secret"},
+		{"/panic", "secret"},
+		{"/hello", "secret"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, req.path, nil)
+		r.Header.Set(RequestIDHeader, "demo")
+		if req.token != "" {
+			r.Header.Set("Authorization", "Bearer "+req.token)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		fmt.Printf("GET %s: %d %s\n", req.path, w.Code, strings.TrimSpace(w.Body.String()))
+	}
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type sampleKey struct {
+	level   int
+	message string
+}
+
+type sample struct {
+	start      time.Time
+	suppressed int
+}
+
+// ConcreteHandler that lets the first occurrence of a message through and
+// suppresses repeats within a window, reporting how many were suppressed.
+// Summaries are emitted when a later record arrives after the window, or by a
+// timer if none does.
+type SamplingLogger struct {
+	link
+	window time.Duration
+
+	mu        sync.Mutex
+	samples   map[sampleKey]*sample
+	lastSweep time.Time
+	timer     *time.Timer // pending while any message is being suppressed
+}
+
+func NewSamplingLogger(window time.Duration) *SamplingLogger {
+	return &SamplingLogger{window: window, samples: make(map[sampleKey]*sample)}
+}
+
+func (s *SamplingLogger) LogMessage(r Record) (bool, error) {
+	now := r.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	key := sampleKey{r.Level, r.Message}
+
+	s.mu.Lock()
+	var summaries []Record
+	if now.Sub(s.lastSweep) >= s.window {
+		summaries = s.sweep(now)
+		s.lastSweep = now
+	}
+	if smp, ok := s.samples[key]; ok && now.Sub(smp.start) < s.window {
+		smp.suppressed++
+		if s.timer == nil {
+			s.timer = time.AfterFunc(s.window, s.expire)
+		}
+		s.mu.Unlock()
+		_, err := s.emit(summaries)
+		return true, err
+	}
+	if smp, ok := s.samples[key]; ok && smp.suppressed > 0 {
+		summaries = append(summaries, summaryRecord(key, smp.suppressed, now))
+	}
+	s.samples[key] = &sample{start: now}
+	s.mu.Unlock()
+
+	if _, err := s.emit(summaries); err != nil {
+		return false, err
+	}
+	return s.forward(r, false)
+}
+
+// sweep forgets expired messages and returns summaries for those that had repeats
+func (s *SamplingLogger) sweep(now time.Time) []Record {
+	var summaries []Record
+	for key, smp := range s.samples {
+		if now.Sub(smp.start) < s.window {
+			continue
+		}
+		if smp.suppressed > 0 {
+			summaries = append(summaries, summaryRecord(key, smp.suppressed, now))
+		}
+		delete(s.samples, key)
+	}
+	return summaries
+}
+
+// expire emits the summaries of windows that ended without a later record.
+// The rest of the chain is called from the timer's goroutine, so its errors
+// are dropped.
+func (s *SamplingLogger) expire() {
+	s.mu.Lock()
+	now := time.Now()
+	summaries := s.sweep(now)
+	s.lastSweep = now
+	s.timer = nil
+	for _, smp := range s.samples {
+		if smp.suppressed > 0 {
+			s.timer = time.AfterFunc(s.window, s.expire)
+			break
+		}
+	}
+	s.mu.Unlock()
+	s.emit(summaries)
+}
+
+func summaryRecord(key sampleKey, suppressed int, now time.Time) Record {
+	return Record{
+		Level:   key.level,
+		Message: fmt.Sprintf("%d messages suppressed", suppressed),
+		Time:    now,
+		Fields:  []Field{{Key: "message", Value: key.message}},
+	}
+}
+
+func (s *SamplingLogger) emit(summaries []Record) (bool, error) {
+	var handled bool
+	var errs []error
+	for _, r := range summaries {
+		ok, err := s.forward(r, false)
+		handled = handled || ok
+		errs = append(errs, err)
+	}
+	return handled, errors.Join(errs...)
+}
+
+// Flush emits summaries for every message that is currently being suppressed
+func (s *SamplingLogger) Flush() error {
+	s.mu.Lock()
+	var summaries []Record
+	now := time.Now()
+	for key, smp := range s.samples {
+		if smp.suppressed > 0 {
+			summaries = append(summaries, summaryRecord(key, smp.suppressed, now))
+			smp.suppressed = 0
+		}
+	}
+	s.mu.Unlock()
+	_, err := s.emit(summaries)
+	return err
+}
+
+// Close stops the timer and emits pending summaries
+func (s *SamplingLogger) Close() error {
+	s.mu.Lock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.mu.Unlock()
+	return s.Flush()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+func levelFromSlog(l slog.Level) int {
+	switch {
+	case l >= slog.LevelError:
+		return Error
+	case l >= slog.LevelWarn:
+		return Warning
+	}
+	return Info
+}
+
+func levelToSlog(level int) slog.Level {
+	switch {
+	case level >= Error:
+		return slog.LevelError
+	case level >= Warning:
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+// SlogHandler adapts a chain of Loggers to the slog.Handler interface
+type SlogHandler struct {
+	logger Logger
+	level  int
+	fields []Field
+	prefix string // dotted path of the groups opened with WithGroup
+}
+
+// NewSlogHandler exposes logger to slog, dropping records below level
+func NewSlogHandler(logger Logger, level int) *SlogHandler {
+	return &SlogHandler{logger: logger, level: level}
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, l slog.Level) bool {
+	// Compared on slog's scale, so that Debug stays below Info
+	return l >= levelToSlog(h.level)
+}
+
+func (h *SlogHandler) Handle(_ context.Context, r slog.Record) error {
+	fields := make([]Field, len(h.fields), len(h.fields)+r.NumAttrs())
+	copy(fields, h.fields)
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendAttr(fields, h.prefix, a)
+		return true
+	})
+	_, err := h.logger.LogMessage(Record{
+		Level:   levelFromSlog(r.Level),
+		Message: r.Message,
+		Time:    r.Time,
+		Fields:  fields,
+	})
+	return err
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	clone := *h
+	clone.fields = make([]Field, len(h.fields), len(h.fields)+len(attrs))
+	copy(clone.fields, h.fields)
+	for _, a := range attrs {
+		clone.fields = appendAttr(clone.fields, h.prefix, a)
+	}
+	return &clone
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+// appendAttr flattens a, qualifying keys of nested groups with their path
+func appendAttr(fields []Field, prefix string, a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendAttr(fields, prefix, ga)
+		}
+		return fields
+	}
+	return append(fields, Field{Key: prefix + a.Key, Value: a.Value.Any()})
+}
+
+// ConcreteHandler forwarding records to a slog.Logger
+type SlogLogger struct {
+	link
+	levelFilter
+	logger *slog.Logger
+}
+
+func NewSlogLogger(logger *slog.Logger, level int, mode Mode) *SlogLogger {
+	s := &SlogLogger{link: link{mode: mode}, logger: logger}
+	s.SetLevel(level)
+	return s
+}
+
+func (s *SlogLogger) LogMessage(r Record) (bool, error) {
+	ctx := context.Background()
+	l := levelToSlog(r.Level)
+	if !s.enabled(r.Level) || !s.logger.Enabled(ctx, l) {
+		return s.forward(r, false)
+	}
+	sr := slog.NewRecord(r.Time, l, r.Message, 0)
+	for _, f := range r.Fields {
+		sr.AddAttrs(slog.Any(f.Key, f.Value))
+	}
+	if err := s.logger.Handler().Handle(ctx, sr); err != nil {
+		return false, err
+	}
+	return s.forward(r, true)
+}
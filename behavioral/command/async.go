@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrInvokerClosed = errors.New("invoker is closed")
+
+// Invoker is what AsyncInvoker drives; both CommandInvoker and Journal qualify
+type Invoker interface {
+	Execute(Command) error
+	Undo() error
+	Redo() error
+}
+
+// Future is the pending result of work submitted to an AsyncInvoker
+type Future struct {
+	done chan struct{}
+	err  error
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+func (f *Future) resolve(err error) {
+	f.err = err
+	close(f.done)
+}
+
+// Done is closed once the work has run or been cancelled
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the work has run or ctx is done, and returns its error
+func (f *Future) Wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type task struct {
+	ctx    context.Context
+	run    func() error
+	future *Future
+}
+
+// AsyncInvoker accepts commands from many goroutines and executes them one at
+// a time, in the order they were submitted, on a single goroutine
+type AsyncInvoker struct {
+	invoker Invoker
+	tasks   chan task
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncInvoker queues up to queueSize submissions before Submit blocks
+func NewAsyncInvoker(invoker Invoker, queueSize int) *AsyncInvoker {
+	a := &AsyncInvoker{
+		invoker: invoker,
+		tasks:   make(chan task, queueSize),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *AsyncInvoker) run() {
+	defer close(a.done)
+	for t := range a.tasks {
+		// Work cancelled while it was waiting in the queue is skipped
+		if err := t.ctx.Err(); err != nil {
+			t.future.resolve(err)
+			continue
+		}
+		t.future.resolve(t.run())
+	}
+}
+
+// Submit queues a command for execution. Cancelling ctx before the command
+// starts removes it from the queue.
+func (a *AsyncInvoker) Submit(ctx context.Context, c Command) *Future {
+	return a.enqueue(ctx, func() error { return a.invoker.Execute(c) })
+}
+
+func (a *AsyncInvoker) Undo(ctx context.Context) *Future {
+	return a.enqueue(ctx, a.invoker.Undo)
+}
+
+func (a *AsyncInvoker) Redo(ctx context.Context) *Future {
+	return a.enqueue(ctx, a.invoker.Redo)
+}
+
+// Do runs fn on the executor goroutine, in order with the queued commands.
+// Use it to read the receiver without racing with commands.
+func (a *AsyncInvoker) Do(ctx context.Context, fn func() error) *Future {
+	return a.enqueue(ctx, fn)
+}
+
+func (a *AsyncInvoker) enqueue(ctx context.Context, run func() error) *Future {
+	f := newFuture()
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		f.resolve(ErrInvokerClosed)
+		return f
+	}
+	select {
+	case a.tasks <- task{ctx: ctx, run: run, future: f}:
+	case <-ctx.Done():
+		f.resolve(ctx.Err())
+	}
+	return f
+}
+
+// Close stops accepting work and waits until everything already queued has run
+func (a *AsyncInvoker) Close() error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.tasks)
+	}
+	a.mu.Unlock()
+	<-a.done
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingInvoker notes every operation in the order the executor runs it.
+// It is not synchronized, so the race detector reports any operation that
+// runs outside the executor goroutine.
+type recordingInvoker struct {
+	*CommandInvoker
+	ops []string // "+text", "undo" or "redo"
+}
+
+func (r *recordingInvoker) Execute(c Command) error {
+	r.ops = append(r.ops, "+"+c.(*AddTextCommand).text)
+	return r.CommandInvoker.Execute(c)
+}
+
+func (r *recordingInvoker) Undo() error {
+	r.ops = append(r.ops, "undo")
+	return r.CommandInvoker.Undo()
+}
+
+func (r *recordingInvoker) Redo() error {
+	r.ops = append(r.ops, "redo")
+	return r.CommandInvoker.Redo()
+}
+
+// Run with -race to check that commands only touch the editor from the
+// executor goroutine
+func TestAsyncInvokerConcurrentUse(t *testing.T) {
+	const writers, steps = 8, 200
+	editor := &TextEditor{}
+	recorder := &recordingInvoker{CommandInvoker: NewCommandInvoker(0)}
+	async := NewAsyncInvoker(recorder, 4)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for g := 0; g < writers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			var futures []*Future
+			for i := 0; i < steps; i++ {
+				var f *Future
+				switch {
+				case g%4 == 3 && i%2 == 0:
+					f = async.Undo(ctx)
+				case g%4 == 3:
+					f = async.Redo(ctx)
+				default:
+					f = async.Submit(ctx, &AddTextCommand{editor: editor, text: string(rune('a' + g))})
+				}
+				futures = append(futures, f)
+			}
+			for _, f := range futures {
+				if err := f.Wait(ctx); err != nil {
+					t.Error(err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	var text string
+	async.Do(ctx, func() error {
+		text = editor.Text()
+		return nil
+	}).Wait(ctx)
+	if err := async.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.ops) != writers*steps {
+		t.Fatalf("ran %d operations, want %d", len(recorder.ops), writers*steps)
+	}
+	// Running the same operations one after another gives the same text
+	replayed := &TextEditor{}
+	invoker := NewCommandInvoker(0)
+	for _, op := range recorder.ops {
+		var err error
+		switch op {
+		case "undo":
+			err = invoker.Undo()
+		case "redo":
+			err = invoker.Redo()
+		default:
+			err = invoker.Execute(&AddTextCommand{editor: replayed, text: op[1:]})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if text != replayed.Text() {
+		t.Fatalf("text = %q, replaying the executed order gives %q", text, replayed.Text())
+	}
+	// Every remaining letter is one step of history
+	if len(text) != len(recorder.history) {
+		t.Errorf("text has %d letters and %d undo steps", len(text), len(recorder.history))
+	}
+	for g := 0; g < writers; g++ {
+		letter := string(rune('a' + g))
+		if n := strings.Count(text, letter); n > steps {
+			t.Errorf("%q appears %d times, more than it was added", letter, n)
+		}
+	}
+}
+
+func TestAsyncInvokerKeepsSubmissionOrder(t *testing.T) {
+	editor := &TextEditor{}
+	async := NewAsyncInvoker(NewCommandInvoker(0), 0)
+	ctx := context.Background()
+	var last *Future
+	for i := 0; i < 10; i++ {
+		last = async.Submit(ctx, &AddTextCommand{editor: editor, text: fmt.Sprint(i)})
+	}
+	async.Undo(ctx)
+	async.Undo(ctx)
+	last = async.Redo(ctx)
+	if err := last.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	async.Close()
+	if got := editor.Text(); got != "012345678" {
+		t.Errorf("text = %q, want %q", got, "012345678")
+	}
+
+	if err := async.Submit(ctx, &AddTextCommand{editor: editor, text: "x"}).Wait(ctx); !errors.Is(err, ErrInvokerClosed) {
+		t.Errorf("Submit after Close: err = %v", err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	open := NewAsyncInvoker(NewCommandInvoker(0), 1)
+	defer open.Close()
+	if err := open.Submit(cancelled, &AddTextCommand{editor: editor, text: "x"}).Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled Submit: err = %v", err)
+	}
+}
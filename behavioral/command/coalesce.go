@@ -0,0 +1,74 @@
+package main
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+// Merger is implemented by commands that can absorb the command executed
+// right after them, so that both are undone in a single step
+type Merger interface {
+	// MergeWith folds next, which has already been executed, into the
+	// receiver and reports whether it did.
+	MergeWith(next Command) bool
+}
+
+// SetMergeWindow makes the invoker coalesce compatible commands executed
+// within d of each other into one undo step. Zero disables coalescing.
+func (i *CommandInvoker) SetMergeWindow(d time.Duration) {
+	i.mergeWindow = d
+}
+
+// MarkUndoBoundary makes the next command start a new undo step even if it
+// could be merged into the previous one
+func (i *CommandInvoker) MarkUndoBoundary() {
+	i.boundary = true
+}
+
+func (i *CommandInvoker) mergeIntoLast(c Command) bool {
+	if len(i.history) == 0 {
+		return false
+	}
+	last, ok := i.history[len(i.history)-1].(Merger)
+	return ok && last.MergeWith(c)
+}
+
+// MergeWith absorbs text appended right after this command's text
+func (c *AddTextCommand) MergeWith(next Command) bool {
+	n, ok := next.(*AddTextCommand)
+	if !ok || n.editor != c.editor {
+		return false
+	}
+	c.text += n.text
+	return true
+}
+
+// MergeWith absorbs text inserted right after the text this command inserted
+func (c *InsertTextCommand) MergeWith(next Command) bool {
+	n, ok := next.(*InsertTextCommand)
+	if !ok || n.editor != c.editor || n.pos != c.pos+utf8.RuneCountInString(c.text) {
+		return false
+	}
+	c.text += n.text
+	return true
+}
+
+// MergeWith absorbs a deletion that continues this one, either backwards
+// (backspace) or forwards (delete key)
+func (c *DeleteRangeCommand) MergeWith(next Command) bool {
+	n, ok := next.(*DeleteRangeCommand)
+	if !ok || n.editor != c.editor {
+		return false
+	}
+	switch {
+	case n.end == c.start:
+		c.start = n.start
+		c.deleted = n.deleted + c.deleted
+	case n.start == c.start:
+		c.end += n.end - n.start
+		c.deleted += n.deleted
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// message travels from the server to a client
+type message struct {
+	op  Operation
+	ack bool // acknowledges the client's own outstanding operation
+}
+
+// Server orders the operations of every client. Each incoming operation is
+// transformed against the operations the client had not seen yet, recorded,
+// and broadcast to the other clients.
+type Server struct {
+	mu      sync.Mutex
+	text    string
+	history []Operation
+	inboxes map[string][]message
+}
+
+func NewServer(text string) *Server {
+	return &Server{text: text, inboxes: make(map[string][]message)}
+}
+
+// Connect registers a client and loads the current document into its editor
+func (s *Server) Connect(id string, editor *TextEditor) *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inboxes[id] = nil
+	editor.text = []rune(s.text)
+	editor.cursor = 0
+	return &Client{id: id, server: s, editor: editor, revision: len(s.history)}
+}
+
+func (s *Server) Text() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.text
+}
+
+func (s *Server) receive(from string, revision int, op Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if revision < 0 || revision > len(s.history) {
+		return fmt.Errorf("client %s: unknown revision %d", from, revision)
+	}
+	for _, concurrent := range s.history[revision:] {
+		var err error
+		if op, _, err = Transform(op, concurrent); err != nil {
+			return fmt.Errorf("client %s: %w", from, err)
+		}
+	}
+	text, err := op.Apply(s.text)
+	if err != nil {
+		return fmt.Errorf("client %s: %w", from, err)
+	}
+	s.text = text
+	s.history = append(s.history, op)
+	for id := range s.inboxes {
+		s.inboxes[id] = append(s.inboxes[id], message{op: op, ack: id == from})
+	}
+	return nil
+}
+
+func (s *Server) takeMessages(id string) []message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := s.inboxes[id]
+	s.inboxes[id] = nil
+	return messages
+}
+
+// Client keeps one replica of the document in a TextEditor. Local commands
+// are applied at once and sent to the server; at most one operation is in
+// flight, and edits made meanwhile are buffered into a single operation.
+type Client struct {
+	id       string
+	server   *Server
+	editor   *TextEditor
+	revision int // server operations this replica has seen
+
+	mu          sync.Mutex
+	outstanding *Operation // sent to the server, not yet acknowledged
+	buffer      *Operation // made locally while waiting for the acknowledgement
+}
+
+// Execute applies a text command locally and shares it with the other clients
+func (c *Client) Execute(cmd Command) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	op, err := OperationFor(cmd, c.editor.Len())
+	if err != nil {
+		return err
+	}
+	if err := cmd.Execute(); err != nil {
+		return err
+	}
+	switch {
+	case c.outstanding == nil:
+		c.outstanding = &op
+		return c.server.receive(c.id, c.revision, op)
+	case c.buffer == nil:
+		c.buffer = &op
+	default:
+		composed, err := Compose(*c.buffer, op)
+		if err != nil {
+			return err
+		}
+		c.buffer = &composed
+	}
+	return nil
+}
+
+// Sync applies the operations the server has delivered since the last call
+func (c *Client) Sync() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, m := range c.server.takeMessages(c.id) {
+		c.revision++
+		var err error
+		if m.ack {
+			err = c.acknowledged()
+		} else {
+			err = c.applyRemote(m.op)
+		}
+		if err != nil {
+			return fmt.Errorf("client %s: %w", c.id, err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) acknowledged() error {
+	c.outstanding, c.buffer = c.buffer, nil
+	if c.outstanding == nil {
+		return nil
+	}
+	return c.server.receive(c.id, c.revision, *c.outstanding)
+}
+
+// applyRemote transforms a server operation past the local edits the server
+// has not seen yet and applies it to the editor
+func (c *Client) applyRemote(op Operation) error {
+	for _, pending := range []**Operation{&c.outstanding, &c.buffer} {
+		if *pending == nil {
+			continue
+		}
+		local, remote, err := Transform(**pending, op)
+		if err != nil {
+			return err
+		}
+		*pending, op = &local, remote
+	}
+	return op.ApplyTo(c.editor)
+}
+
+// Text returns the client's replica of the document
+func (c *Client) Text() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.editor.Text()
+}
+
+// Pending reports whether the client has edits the server has not acknowledged
+func (c *Client) Pending() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.outstanding != nil
+}
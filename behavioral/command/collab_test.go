@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"unicode/utf8"
+)
+
+// randomOperation edits a document of the given length at random
+func randomOperation(r *rand.Rand, length int) Operation {
+	var o Operation
+	for pos := 0; pos < length; {
+		n := 1 + r.Intn(length-pos)
+		switch r.Intn(3) {
+		case 0:
+			o.Retain(n)
+		case 1:
+			o.Delete(n)
+		default:
+			o.Insert(randomText(r, 3))
+			continue
+		}
+		pos += n
+	}
+	if r.Intn(2) == 0 {
+		o.Insert(randomText(r, 3))
+	}
+	return o
+}
+
+func mustApply(t *testing.T, o Operation, text string) string {
+	t.Helper()
+	result, err := o.Apply(text)
+	if err != nil {
+		t.Fatalf("apply %v to %q: %v", o, text, err)
+	}
+	return result
+}
+
+func TestTransformConverges(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		doc := randomText(r, 10)
+		length := utf8.RuneCountInString(doc)
+		a, b := randomOperation(r, length), randomOperation(r, length)
+		aPrime, bPrime, err := Transform(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		viaA := mustApply(t, bPrime, mustApply(t, a, doc))
+		viaB := mustApply(t, aPrime, mustApply(t, b, doc))
+		if viaA != viaB {
+			t.Fatalf("doc %q, a = %v, b = %v: a then b' gives %q, b then a' gives %q", doc, a, b, viaA, viaB)
+		}
+	}
+}
+
+func TestTransformIdentity(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 1000; i++ {
+		length := r.Intn(10)
+		a := randomOperation(r, length)
+		var identity Operation
+		identity.Retain(length)
+		aPrime, identityPrime, err := Transform(a, identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if aPrime.String() != a.String() {
+			t.Fatalf("transforming %v against the identity gives %v", a, aPrime)
+		}
+		var want Operation
+		want.Retain(a.TargetLen)
+		if identityPrime.String() != want.String() || identityPrime.BaseLen != a.TargetLen {
+			t.Fatalf("the identity transformed against %v gives %v, want %v", a, identityPrime, want)
+		}
+	}
+}
+
+func TestTransformTieBreak(t *testing.T) {
+	var a, b Operation
+	a.Retain(1).Insert("ä").Retain(1)
+	b.Retain(1).Insert("世").Retain(1)
+	aPrime, bPrime, err := Transform(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, got := range []string{mustApply(t, bPrime, mustApply(t, a, "xy")), mustApply(t, aPrime, mustApply(t, b, "xy"))} {
+		if got != "xä世y" {
+			t.Errorf("got %q, want %q", got, "xä世y")
+		}
+	}
+}
+
+func TestCompose(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 5000; i++ {
+		doc := randomText(r, 10)
+		a := randomOperation(r, utf8.RuneCountInString(doc))
+		b := randomOperation(r, a.TargetLen)
+		ab, err := Compose(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := mustApply(t, b, mustApply(t, a, doc))
+		if got := mustApply(t, ab, doc); got != want {
+			t.Fatalf("doc %q, a = %v, b = %v: composed %v gives %q, want %q", doc, a, b, ab, got, want)
+		}
+	}
+}
+
+func TestComposeIdentity(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	for i := 0; i < 1000; i++ {
+		length := r.Intn(10)
+		a := randomOperation(r, length)
+		var before, after Operation
+		before.Retain(length)
+		after.Retain(a.TargetLen)
+		for _, pair := range [][2]Operation{{before, a}, {a, after}} {
+			composed, err := Compose(pair[0], pair[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if composed.String() != a.String() {
+				t.Fatalf("composing %v with the identity gives %v", a, composed)
+			}
+		}
+	}
+	var a, b Operation
+	a.Retain(2)
+	b.Retain(3)
+	if _, err := Compose(a, b); err == nil {
+		t.Error("composed operations of mismatched lengths")
+	}
+}
+
+// Clients edit concurrently and sync at random; once every message has been
+// delivered, every replica must equal the server's document.
+func TestCollaborationConverges(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	for session := 0; session < 500; session++ {
+		server := NewServer(randomText(r, 6))
+		clients := make([]*Client, 2+r.Intn(3))
+		for i := range clients {
+			clients[i] = server.Connect(fmt.Sprint("client", i), &TextEditor{})
+		}
+		for step := 0; step < 40; step++ {
+			c := clients[r.Intn(len(clients))]
+			if r.Intn(3) == 0 {
+				if err := c.Sync(); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			start, end := r.Float64(), r.Float64()
+			if start > end {
+				start, end = end, start
+			}
+			edit := editStep{kind: r.Intn(4), start: start, end: end, text: randomText(r, 3)}
+			if err := c.Execute(edit.command(c.editor)); err != nil {
+				t.Fatalf("session %d: %v", session, err)
+			}
+		}
+		// Each sync may send a buffered operation, so keep going until quiet
+		for round := 0; round < 10; round++ {
+			for _, c := range clients {
+				if err := c.Sync(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		want := server.Text()
+		for i, c := range clients {
+			if c.Pending() {
+				t.Fatalf("session %d: client %d still has unacknowledged edits", session, i)
+			}
+			if got := c.Text(); got != want {
+				t.Fatalf("session %d: client %d has %q, server has %q", session, i, got, want)
+			}
+		}
+	}
+}
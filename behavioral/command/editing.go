@@ -0,0 +1,97 @@
+package main
+
+import "unicode/utf8"
+
+// ConcreteCommand for inserting text at a position
+type InsertTextCommand struct {
+	editor *TextEditor
+	pos    int
+	text   string
+
+	cursor int // where the cursor was before
+}
+
+func (c *InsertTextCommand) Execute() error {
+	c.cursor = c.editor.Cursor()
+	return c.editor.InsertAt(c.pos, c.text)
+}
+
+func (c *InsertTextCommand) Unexecute() error {
+	if _, err := c.editor.DeleteRange(c.pos, c.pos+utf8.RuneCountInString(c.text)); err != nil {
+		return err
+	}
+	return c.editor.MoveCursor(c.cursor)
+}
+
+// ConcreteCommand for deleting the text between two positions
+type DeleteRangeCommand struct {
+	editor     *TextEditor
+	start, end int
+
+	deleted string
+	cursor  int
+}
+
+func (c *DeleteRangeCommand) Execute() error {
+	c.cursor = c.editor.Cursor()
+	deleted, err := c.editor.DeleteRange(c.start, c.end)
+	if err != nil {
+		return err
+	}
+	c.deleted = deleted
+	return nil
+}
+
+func (c *DeleteRangeCommand) Unexecute() error {
+	if err := c.editor.InsertAt(c.start, c.deleted); err != nil {
+		return err
+	}
+	return c.editor.MoveCursor(c.cursor)
+}
+
+// ConcreteCommand for replacing the text between two positions
+type ReplaceCommand struct {
+	editor     *TextEditor
+	start, end int
+	text       string
+
+	replaced string
+	cursor   int
+}
+
+func (c *ReplaceCommand) Execute() error {
+	c.cursor = c.editor.Cursor()
+	replaced, err := c.editor.DeleteRange(c.start, c.end)
+	if err != nil {
+		return err
+	}
+	c.replaced = replaced
+	return c.editor.InsertAt(c.start, c.text)
+}
+
+func (c *ReplaceCommand) Unexecute() error {
+	if _, err := c.editor.DeleteRange(c.start, c.start+utf8.RuneCountInString(c.text)); err != nil {
+		return err
+	}
+	if err := c.editor.InsertAt(c.start, c.replaced); err != nil {
+		return err
+	}
+	return c.editor.MoveCursor(c.cursor)
+}
+
+// ConcreteCommand for moving the cursor
+type MoveCursorCommand struct {
+	editor *TextEditor
+	pos    int
+
+	previous int
+}
+
+func (c *MoveCursorCommand) Execute() error {
+	c.previous = c.editor.Cursor()
+	return c.editor.MoveCursor(c.pos)
+}
+
+func (c *MoveCursorCommand) Unexecute() error {
+	return c.editor.MoveCursor(c.previous)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"unicode/utf8"
+)
+
+// editStep is one random command. Positions are fractions of the text length
+// at the time the step runs, so every step is valid whatever came before.
+type editStep struct {
+	kind       int // 0 insert, 1 delete range, 2 replace, 3 move cursor
+	start, end float64
+	text       string
+}
+
+// editScript is a random document and a sequence of commands to run on it
+type editScript struct {
+	initial string
+	steps   []editStep
+}
+
+// Runes that are easy to mishandle as bytes: multibyte letters, CJK, emoji
+// outside the BMP and combining marks
+var tricky = []rune{'a', 'Z', ' ', '\n', 'é', 'ß', 'Ж', '世', '界', '🙂', '𝄞', '\u0301', '\u200d', '\ufeff'}
+
+func randomText(r *rand.Rand, maxLen int) string {
+	var b strings.Builder
+	for i := r.Intn(maxLen + 1); i > 0; i-- {
+		if r.Intn(2) == 0 {
+			b.WriteRune(tricky[r.Intn(len(tricky))])
+			continue
+		}
+		// Any valid code point
+		for {
+			if c := rune(r.Int31n(utf8.MaxRune + 1)); utf8.ValidRune(c) {
+				b.WriteRune(c)
+				break
+			}
+		}
+	}
+	return b.String()
+}
+
+func (editScript) Generate(r *rand.Rand, size int) reflect.Value {
+	s := editScript{initial: randomText(r, 8)}
+	for i := r.Intn(size + 1); i > 0; i-- {
+		start, end := r.Float64(), r.Float64()
+		if start > end {
+			start, end = end, start
+		}
+		s.steps = append(s.steps, editStep{kind: r.Intn(4), start: start, end: end, text: randomText(r, 5)})
+	}
+	return reflect.ValueOf(s)
+}
+
+func (s editStep) command(editor *TextEditor) Command {
+	at := func(f float64) int { return int(f * float64(editor.Len()+1) * 0.999) }
+	switch s.kind {
+	case 0:
+		return &InsertTextCommand{editor: editor, pos: at(s.start), text: s.text}
+	case 1:
+		return &DeleteRangeCommand{editor: editor, start: at(s.start), end: at(s.end)}
+	case 2:
+		return &ReplaceCommand{editor: editor, start: at(s.start), end: at(s.end), text: s.text}
+	}
+	return &MoveCursorCommand{editor: editor, pos: at(s.start)}
+}
+
+type editorState struct {
+	text   string
+	cursor int
+}
+
+func stateOf(editor *TextEditor) editorState {
+	return editorState{editor.Text(), editor.Cursor()}
+}
+
+// Undoing every command restores every earlier state, text and cursor, in
+// reverse order, and redoing them all replays the same states again.
+func TestEditingRoundTrips(t *testing.T) {
+	property := func(s editScript) bool {
+		editor := &TextEditor{}
+		editor.Add(s.initial)
+		invoker := NewCommandInvoker(0)
+		states := []editorState{stateOf(editor)}
+		for _, step := range s.steps {
+			if err := invoker.Execute(step.command(editor)); err != nil {
+				t.Logf("execute %+v: %v", step, err)
+				return false
+			}
+			states = append(states, stateOf(editor))
+		}
+		for i := len(states) - 2; i >= 0; i-- {
+			if err := invoker.Undo(); err != nil || stateOf(editor) != states[i] {
+				t.Logf("undo to step %d: %+v (%v), want %+v", i, stateOf(editor), err, states[i])
+				return false
+			}
+		}
+		for i := 1; i < len(states); i++ {
+			if err := invoker.Redo(); err != nil || stateOf(editor) != states[i] {
+				t.Logf("redo to step %d: %+v (%v), want %+v", i, stateOf(editor), err, states[i])
+				return false
+			}
+		}
+		return !invoker.CanRedo() && utf8.ValidString(editor.Text())
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+// Positions count runes, so an edit never splits a multibyte character
+func TestEditingCountsRunes(t *testing.T) {
+	editor := &TextEditor{}
+	editor.Add("h🙂llo 世界")
+	invoker := NewCommandInvoker(0)
+	steps := []struct {
+		cmd  Command
+		want string
+	}{
+		{&ReplaceCommand{editor: editor, start: 1, end: 2, text: "é"}, "héllo 世界"},
+		{&DeleteRangeCommand{editor: editor, start: 6, end: 7}, "héllo 界"},
+		{&InsertTextCommand{editor: editor, pos: 6, text: "𝄞"}, "héllo 𝄞界"},
+	}
+	for _, step := range steps {
+		if err := invoker.Execute(step.cmd); err != nil {
+			t.Fatal(err)
+		}
+		if got := editor.Text(); got != step.want {
+			t.Fatalf("after %T: %q, want %q", step.cmd, got, step.want)
+		}
+	}
+	if err := invoker.Execute(&DeleteRangeCommand{editor: editor, start: 5, end: 99}); err == nil {
+		t.Error("deleting past the end succeeded")
+	}
+	if editor.Text() != "héllo 𝄞界" {
+		t.Errorf("failed command changed the text to %q", editor.Text())
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	journalFile    = "journal.log"
+	checkpointFile = "checkpoint.json"
+)
+
+// Journal operations
+const (
+	opExecute = "execute"
+	opUndo    = "undo"
+	opRedo    = "redo"
+)
+
+// ErrCheckpoint marks a failed automatic checkpoint. The operation that
+// triggered it was recorded and has taken effect; only the snapshot is
+// missing, and it is tried again after the next record.
+var ErrCheckpoint = errors.New("journal: automatic checkpoint failed")
+
+// journalRecord is one line of the journal
+type journalRecord struct {
+	Seq     uint64          `json:"seq"`
+	Op      string          `json:"op"`
+	Command *encodedCommand `json:"command,omitempty"`
+	Merged  bool            `json:"merged,omitempty"` // folded into the previous undo step
+}
+
+// checkpoint is a snapshot of the editor covering every record up to Seq
+type checkpoint struct {
+	Seq    uint64 `json:"seq"`
+	Text   string `json:"text"`
+	Cursor int    `json:"cursor"`
+}
+
+// Journal wraps a CommandInvoker and appends every command, undo and redo to
+// an on-disk journal, so that the editor can be reconstructed after a restart.
+type Journal struct {
+	dir             string
+	file            *os.File
+	editor          *TextEditor
+	invoker         *CommandInvoker
+	seq             uint64
+	sinceCheckpoint int
+	checkpointEvery int // 0 disables automatic checkpoints
+}
+
+// OpenJournal restores editor from the journal in dir, replaying recorded
+// commands through invoker, and then keeps recording. A record cut short by a
+// crash at the end of the journal is discarded.
+func OpenJournal(dir string, editor *TextEditor, invoker *CommandInvoker, checkpointEvery int) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("journal: %w", err)
+	}
+	j := &Journal{dir: dir, editor: editor, invoker: invoker, checkpointEvery: checkpointEvery}
+	if err := j.loadCheckpoint(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("journal: %w", err)
+	}
+	j.file = file
+	if err := j.replay(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Journal) loadCheckpoint() error {
+	data, err := os.ReadFile(filepath.Join(j.dir, checkpointFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return fmt.Errorf("journal: checkpoint: %w", err)
+	}
+	j.editor.text = []rune(cp.Text)
+	j.editor.cursor = cp.Cursor
+	j.seq = cp.Seq
+	return nil
+}
+
+func (j *Journal) replay() error {
+	r := bufio.NewReader(j.file)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// Whatever follows the last newline is a record torn by a crash
+			if len(line) > 0 {
+				return j.truncate(offset)
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("journal: %w", err)
+		}
+
+		var rec journalRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			if _, peekErr := r.Peek(1); peekErr == io.EOF {
+				return j.truncate(offset)
+			}
+			return fmt.Errorf("journal: corrupt record at offset %d: %w", offset, err)
+		}
+		offset += int64(len(line))
+
+		// Records already covered by the checkpoint
+		if rec.Seq <= j.seq {
+			continue
+		}
+		if err := j.apply(rec); err != nil {
+			return fmt.Errorf("journal: replay record %d: %w", rec.Seq, err)
+		}
+		j.seq = rec.Seq
+		j.sinceCheckpoint++
+	}
+	_, err := j.file.Seek(0, io.SeekEnd)
+	return err
+}
+
+func (j *Journal) apply(rec journalRecord) error {
+	switch rec.Op {
+	case opExecute:
+		if rec.Command == nil {
+			return errors.New("execute record without a command")
+		}
+		c, err := decodeCommand(j.editor, *rec.Command)
+		if err != nil {
+			return err
+		}
+		// Merging depends on timing, so repeat the decision that was recorded
+		return j.invoker.execute(c, rec.Merged)
+	case opUndo:
+		return j.invoker.Undo()
+	case opRedo:
+		return j.invoker.Redo()
+	}
+	return fmt.Errorf("unknown operation %q", rec.Op)
+}
+
+func (j *Journal) truncate(offset int64) error {
+	if err := j.file.Truncate(offset); err != nil {
+		return fmt.Errorf("journal: discard torn record: %w", err)
+	}
+	_, err := j.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// Execute runs c and records it. If it cannot be recorded, it is taken back
+// as if it had never run, unless it was merged into the previous undo step.
+func (j *Journal) Execute(c Command) error {
+	e, err := encodeCommand(c)
+	if err != nil {
+		return err
+	}
+	before := j.invoker.state()
+	if err := j.invoker.Execute(c); err != nil {
+		return err
+	}
+	merged := j.invoker.merged
+	if err := j.append(journalRecord{Op: opExecute, Command: &e, Merged: merged}); err != nil {
+		if merged {
+			// The command can no longer be taken back on its own
+			return err
+		}
+		// Keep memory and disk in agreement, without leaving the command on
+		// the redo stack where a later redo would replay it
+		if undoErr := c.Unexecute(); undoErr != nil {
+			return errors.Join(err, undoErr)
+		}
+		j.invoker.restore(before)
+		return err
+	}
+	return j.autoCheckpoint()
+}
+
+func (j *Journal) Undo() error {
+	if !j.invoker.CanUndo() {
+		return nil
+	}
+	if err := j.invoker.Undo(); err != nil {
+		return err
+	}
+	if err := j.append(journalRecord{Op: opUndo}); err != nil {
+		return errors.Join(err, j.invoker.Redo())
+	}
+	return j.autoCheckpoint()
+}
+
+func (j *Journal) Redo() error {
+	if !j.invoker.CanRedo() {
+		return nil
+	}
+	if err := j.invoker.Redo(); err != nil {
+		return err
+	}
+	if err := j.append(journalRecord{Op: opRedo}); err != nil {
+		return errors.Join(err, j.invoker.Undo())
+	}
+	return j.autoCheckpoint()
+}
+
+// append writes rec to the journal and syncs it. A record that cannot be
+// written completely is cut off again, so that the next one starts on a
+// clean line.
+func (j *Journal) append(rec journalRecord) error {
+	rec.Seq = j.seq + 1
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	offset, err := j.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return errors.Join(fmt.Errorf("journal: %w", err), j.truncate(offset))
+	}
+	if err := j.file.Sync(); err != nil {
+		return errors.Join(fmt.Errorf("journal: %w", err), j.truncate(offset))
+	}
+	j.seq++
+	j.sinceCheckpoint++
+	return nil
+}
+
+// autoCheckpoint takes a checkpoint once checkpointEvery records have been
+// appended since the last one. It runs after a record is synced, so a failure
+// never takes back the operation that was recorded.
+func (j *Journal) autoCheckpoint() error {
+	if j.checkpointEvery <= 0 || j.sinceCheckpoint < j.checkpointEvery {
+		return nil
+	}
+	if err := j.Checkpoint(); err != nil {
+		return fmt.Errorf("%w: %w", ErrCheckpoint, err)
+	}
+	return nil
+}
+
+// Checkpoint snapshots the editor and empties the journal. Commands executed
+// before the checkpoint can no longer be undone.
+func (j *Journal) Checkpoint() error {
+	data, err := json.Marshal(checkpoint{Seq: j.seq, Text: j.editor.Text(), Cursor: j.editor.Cursor()})
+	if err != nil {
+		return fmt.Errorf("journal: checkpoint: %w", err)
+	}
+	// Write the snapshot under a temporary name first so a crash never leaves a partial checkpoint
+	tmp := filepath.Join(j.dir, checkpointFile+".tmp")
+	if err := writeFileSync(tmp, data); err != nil {
+		return fmt.Errorf("journal: checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(j.dir, checkpointFile)); err != nil {
+		return fmt.Errorf("journal: checkpoint: %w", err)
+	}
+	// A restart now begins from the snapshot, so the history must go even if
+	// the journal cannot be emptied
+	j.sinceCheckpoint = 0
+	j.invoker.history = nil
+	j.invoker.redoStack = nil
+	// The records are covered by the checkpoint's sequence number even if a
+	// crash stops us before the journal is emptied
+	return j.truncate(0)
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// invokerState is what CommandInvoker.Execute changes besides the history
+// entry it adds
+type invokerState struct {
+	history      []Command
+	redoStack    []Command
+	boundary     bool
+	lastExecuted time.Time
+}
+
+func (i *CommandInvoker) state() invokerState {
+	history := i.history
+	if i.maxHistory > 0 && len(history) >= i.maxHistory {
+		// push shifts a full history in place
+		history = slices.Clone(history)
+	}
+	return invokerState{
+		history:      history,
+		redoStack:    i.redoStack,
+		boundary:     i.boundary,
+		lastExecuted: i.lastExecuted,
+	}
+}
+
+func (i *CommandInvoker) restore(s invokerState) {
+	i.history, i.redoStack, i.boundary, i.lastExecuted = s.history, s.redoStack, s.boundary, s.lastExecuted
+}
+
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type journalSession struct {
+	editor  *TextEditor
+	invoker *CommandInvoker
+	journal *Journal
+}
+
+func openSession(t *testing.T, dir string, checkpointEvery int, mergeWindow time.Duration) *journalSession {
+	t.Helper()
+	s := &journalSession{editor: &TextEditor{}, invoker: NewCommandInvoker(0)}
+	s.invoker.SetMergeWindow(mergeWindow)
+	j, err := OpenJournal(dir, s.editor, s.invoker, checkpointEvery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.journal = j
+	t.Cleanup(func() { j.Close() })
+	return s
+}
+
+func (s *journalSession) add(t *testing.T, text string) {
+	t.Helper()
+	if err := s.journal.Execute(&AddTextCommand{editor: s.editor, text: text}); err != nil {
+		t.Fatalf("add %q: %v", text, err)
+	}
+}
+
+// sameHistory checks that two sessions hold the same text and undo back
+// through the same states
+func sameHistory(t *testing.T, got, want *journalSession) {
+	t.Helper()
+	for step := 0; ; step++ {
+		if stateOf(got.editor) != stateOf(want.editor) {
+			t.Fatalf("after %d undos: state = %+v, want %+v", step, stateOf(got.editor), stateOf(want.editor))
+		}
+		if got.invoker.CanUndo() != want.invoker.CanUndo() || got.invoker.CanRedo() != want.invoker.CanRedo() {
+			t.Fatalf("after %d undos: CanUndo, CanRedo = %v, %v, want %v, %v", step,
+				got.invoker.CanUndo(), got.invoker.CanRedo(), want.invoker.CanUndo(), want.invoker.CanRedo())
+		}
+		if !want.invoker.CanUndo() {
+			return
+		}
+		if err := got.invoker.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		if err := want.invoker.Undo(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	tests := []struct {
+		name            string
+		checkpointEvery int
+		mergeWindow     time.Duration
+	}{
+		{"journal only", 0, 0},
+		{"checkpoint and tail", 3, 0},
+		{"checkpoint every record", 1, 0},
+		{"merged records", 0, time.Hour},
+		{"merged records after a checkpoint", 4, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := openSession(t, dir, tt.checkpointEvery, tt.mergeWindow)
+			steps := []func() error{
+				func() error { return s.journal.Execute(&AddTextCommand{editor: s.editor, text: "Hello"}) },
+				func() error { return s.journal.Execute(&AddTextCommand{editor: s.editor, text: ","}) },
+				func() error { return s.journal.Execute(&AddTextCommand{editor: s.editor, text: " wörld"}) },
+				s.journal.Undo,
+				func() error { return s.journal.Execute(&InsertTextCommand{editor: s.editor, pos: 0, text: "¡"}) },
+				func() error { return s.journal.Execute(&InsertTextCommand{editor: s.editor, pos: 1, text: "¡"}) },
+				func() error { return s.journal.Execute(&AddTextCommand{editor: s.editor, text: "!"}) },
+				s.journal.Undo,
+				s.journal.Undo,
+				s.journal.Redo,
+				func() error { return s.journal.Execute(&DeleteRangeCommand{editor: s.editor, start: 0, end: 1}) },
+				func() error { return s.journal.Execute(&MoveCursorCommand{editor: s.editor, pos: 1}) },
+				s.journal.Undo,
+			}
+			for i, step := range steps {
+				if err := step(); err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+			}
+			s.journal.Close()
+
+			restored := openSession(t, dir, tt.checkpointEvery, tt.mergeWindow)
+			if len(restored.invoker.history) != len(s.invoker.history) {
+				t.Fatalf("%d undo steps after replay, want %d", len(restored.invoker.history), len(s.invoker.history))
+			}
+			sameHistory(t, restored, s)
+		})
+	}
+}
+
+func TestJournalDiscardsTornRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		tail    string
+		wantErr bool
+	}{
+		{"cut before the newline", `{"seq":4,"op":"exe`, false},
+		{"cut after the newline", "{\"seq\":4,\"op\":\"exe\n", false},
+		{"corrupt record before the end", "{\"seq\":4,\"op\n{\"seq\":5,\"op\":\"undo\"}\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := openSession(t, dir, 0, 0)
+			s.add(t, "a")
+			s.add(t, "b")
+			s.add(t, "c")
+			s.journal.Close()
+
+			path := filepath.Join(dir, journalFile)
+			before, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, append(before, tt.tail...), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err = OpenJournal(dir, &TextEditor{}, NewCommandInvoker(0), 0)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("corrupt journal opened")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			restored := openSession(t, dir, 0, 0)
+			if got := restored.editor.Text(); got != "abc" || len(restored.invoker.history) != 3 {
+				t.Fatalf("text = %q with %d undo steps, want %q with 3", got, len(restored.invoker.history), "abc")
+			}
+			after, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(after) != string(before) {
+				t.Fatalf("journal holds %q after recovery, want %q", after, before)
+			}
+
+			// Recording carries on from the recovered end
+			restored.add(t, "d")
+			restored.journal.Close()
+			if got := openSession(t, dir, 0, 0).editor.Text(); got != "abcd" {
+				t.Errorf("text = %q, want %q", got, "abcd")
+			}
+		})
+	}
+}
+
+// failWrites makes the journal's writes fail until the returned function is called
+func failWrites(t *testing.T, dir string, j *Journal) (restore func()) {
+	t.Helper()
+	readOnly, err := os.Open(filepath.Join(dir, journalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readOnly.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	file := j.file
+	j.file = readOnly
+	return func() {
+		j.file = file
+		readOnly.Close()
+	}
+}
+
+func TestJournalTakesBackWhatItCannotRecord(t *testing.T) {
+	dir := t.TempDir()
+	s := openSession(t, dir, 0, 0)
+	s.add(t, "a")
+	s.add(t, "b")
+	if err := s.journal.Undo(); err != nil {
+		t.Fatal(err)
+	}
+
+	restore := failWrites(t, dir, s.journal)
+	if err := s.journal.Execute(&AddTextCommand{editor: s.editor, text: "c"}); err == nil {
+		t.Fatal("unrecorded command succeeded")
+	}
+	// The command is gone without a trace, so redo still brings back "b"
+	if got := s.editor.Text(); got != "a" {
+		t.Fatalf("text = %q after a failed execute, want %q", got, "a")
+	}
+	if len(s.invoker.history) != 1 || len(s.invoker.redoStack) != 1 {
+		t.Fatalf("history and redo stack hold %d and %d commands, want 1 and 1", len(s.invoker.history), len(s.invoker.redoStack))
+	}
+	if err := s.journal.Redo(); err == nil {
+		t.Fatal("unrecorded redo succeeded")
+	}
+	if got := s.editor.Text(); got != "a" {
+		t.Fatalf("text = %q after a failed redo, want %q", got, "a")
+	}
+	restore()
+
+	if err := s.journal.Redo(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.editor.Text(); got != "ab" {
+		t.Fatalf("text = %q after redo, want %q", got, "ab")
+	}
+
+	restore = failWrites(t, dir, s.journal)
+	if err := s.journal.Undo(); err == nil {
+		t.Fatal("unrecorded undo succeeded")
+	}
+	restore()
+	if got := s.editor.Text(); got != "ab" {
+		t.Fatalf("text = %q after a failed undo, want %q", got, "ab")
+	}
+
+	s.journal.Close()
+	sameHistory(t, openSession(t, dir, 0, 0), s)
+}
+
+func TestJournalCheckpointFailureKeepsOperation(t *testing.T) {
+	dir := t.TempDir()
+	// A directory in the way of the temporary checkpoint file makes every
+	// checkpoint fail
+	blocker := filepath.Join(dir, checkpointFile+".tmp")
+	if err := os.Mkdir(blocker, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s := openSession(t, dir, 2, 0)
+	s.add(t, "a")
+	err := s.journal.Execute(&AddTextCommand{editor: s.editor, text: "b"})
+	if !errors.Is(err, ErrCheckpoint) {
+		t.Fatalf("err = %v, want ErrCheckpoint", err)
+	}
+	if got := s.editor.Text(); got != "ab" {
+		t.Fatalf("text = %q, want the command to stand", got)
+	}
+	if err := s.journal.Undo(); !errors.Is(err, ErrCheckpoint) {
+		t.Fatalf("err = %v, want ErrCheckpoint", err)
+	}
+	s.journal.Close()
+
+	restored := openSession(t, dir, 2, 0)
+	if got := restored.editor.Text(); got != "a" || !restored.invoker.CanRedo() {
+		t.Fatalf("text = %q, CanRedo = %v after replay, want %q and true", got, restored.invoker.CanRedo(), "a")
+	}
+
+	// Once the checkpoint can be written, the next record triggers it
+	if err := os.Remove(blocker); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.journal.Redo(); err != nil {
+		t.Fatal(err)
+	}
+	if restored.invoker.CanUndo() {
+		t.Error("history kept after a checkpoint")
+	}
+	if info, err := os.Stat(filepath.Join(dir, journalFile)); err != nil || info.Size() != 0 {
+		t.Errorf("journal not emptied by the checkpoint: %v, %v", info.Size(), err)
+	}
+	restored.journal.Close()
+	if got := openSession(t, dir, 2, 0).editor.Text(); got != "ab" {
+		t.Errorf("text = %q after restoring the checkpoint, want %q", got, "ab")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MacroCommand runs several commands as one. If a command fails, the ones
+// already applied are undone so the receiver is left as it was.
+type MacroCommand struct {
+	commands []Command
+}
+
+func NewMacroCommand(commands ...Command) *MacroCommand {
+	return &MacroCommand{commands: commands}
+}
+
+func (m *MacroCommand) Execute() error {
+	for i, c := range m.commands {
+		if err := c.Execute(); err != nil {
+			err = fmt.Errorf("macro step %d: %w", i+1, err)
+			if rollbackErr := unexecuteAll(m.commands[:i]); rollbackErr != nil {
+				return errors.Join(err, fmt.Errorf("rollback: %w", rollbackErr))
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MacroCommand) Unexecute() error {
+	return unexecuteAll(m.commands)
+}
+
+// unexecuteAll undoes commands in reverse order. If one fails, the ones
+// already undone are executed again.
+func unexecuteAll(commands []Command) error {
+	for i := len(commands) - 1; i >= 0; i-- {
+		if err := commands[i].Unexecute(); err != nil {
+			err = fmt.Errorf("undo macro step %d: %w", i+1, err)
+			for _, c := range commands[i+1:] {
+				if redoErr := c.Execute(); redoErr != nil {
+					return errors.Join(err, fmt.Errorf("rollback: %w", redoErr))
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -1,30 +1,102 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var ErrOutOfRange = errors.New("position out of range")
 
 // Command interface
 type Command interface {
-	Execute()
-	Unexecute()
+	Execute() error
+	Unexecute() error
 }
 
-// Receiver
+// Receiver. Positions count runes, not bytes, so multibyte text is never split.
 type TextEditor struct {
-	text string
+	text   []rune
+	cursor int
 }
 
 func (t *TextEditor) Add(s string) {
-	t.text += s
+	t.text = append(t.text, []rune(s)...)
+}
+
+func (t *TextEditor) Delete(n int) error {
+	if n < 0 || n > len(t.text) {
+		return fmt.Errorf("delete %d characters: %w", n, ErrOutOfRange)
+	}
+	t.text = t.text[:len(t.text)-n]
+	t.cursor = min(t.cursor, len(t.text))
+	return nil
+}
+
+// InsertAt inserts s before the rune at pos and places the cursor after it
+func (t *TextEditor) InsertAt(pos int, s string) error {
+	if err := t.check(pos); err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	inserted := []rune(s)
+	text := make([]rune, 0, len(t.text)+len(inserted))
+	text = append(text, t.text[:pos]...)
+	text = append(text, inserted...)
+	t.text = append(text, t.text[pos:]...)
+	t.cursor = pos + len(inserted)
+	return nil
 }
 
-func (t *TextEditor) Delete(n int) {
-	if n <= len(t.text) {
-		t.text = t.text[:len(t.text)-n]
+// DeleteRange removes the runes in [start, end), places the cursor at start
+// and returns the removed text
+func (t *TextEditor) DeleteRange(start, end int) (string, error) {
+	if err := t.check(start); err != nil {
+		return "", fmt.Errorf("delete: %w", err)
+	}
+	if err := t.check(end); err != nil || end < start {
+		return "", fmt.Errorf("delete [%d, %d): %w", start, end, ErrOutOfRange)
 	}
+	deleted := string(t.text[start:end])
+	t.text = append(t.text[:start], t.text[end:]...)
+	t.cursor = start
+	return deleted, nil
+}
+
+func (t *TextEditor) MoveCursor(pos int) error {
+	if err := t.check(pos); err != nil {
+		return fmt.Errorf("move cursor: %w", err)
+	}
+	t.cursor = pos
+	return nil
+}
+
+func (t *TextEditor) Cursor() int {
+	return t.cursor
+}
+
+// Len returns the length of the text in runes
+func (t *TextEditor) Len() int {
+	return len(t.text)
+}
+
+func (t *TextEditor) Text() string {
+	return string(t.text)
+}
+
+func (t *TextEditor) check(pos int) error {
+	if pos < 0 || pos > len(t.text) {
+		return fmt.Errorf("%d not in [0, %d]: %w", pos, len(t.text), ErrOutOfRange)
+	}
+	return nil
 }
 
 func (t *TextEditor) Display() {
-	fmt.Println(t.text)
+	fmt.Println(string(t.text))
 }
 
 // ConcreteCommand for Adding Text
@@ -33,35 +105,112 @@ type AddTextCommand struct {
 	text   string
 }
 
-func (c *AddTextCommand) Execute() {
+func (c *AddTextCommand) Execute() error {
 	c.editor.Add(c.text)
+	return nil
 }
 
-func (c *AddTextCommand) Unexecute() {
-	c.editor.Delete(len(c.text))
+func (c *AddTextCommand) Unexecute() error {
+	return c.editor.Delete(utf8.RuneCountInString(c.text))
 }
 
 // Invoker
 type CommandInvoker struct {
-	history []Command
+	history    []Command
+	redoStack  []Command
+	maxHistory int // 0 keeps every command
+
+	mergeWindow  time.Duration // 0 disables coalescing
+	lastExecuted time.Time
+	boundary     bool // the next command must start a new undo step
+	merged       bool // the last command was merged into the previous undo step
+}
+
+// NewCommandInvoker remembers at most maxHistory commands for undo, or all of them if maxHistory is 0
+func NewCommandInvoker(maxHistory int) *CommandInvoker {
+	return &CommandInvoker{maxHistory: maxHistory}
+}
+
+// Execute runs the command and records it for undo. A command that fails is
+// not recorded and leaves the redo stack untouched.
+func (i *CommandInvoker) Execute(c Command) error {
+	mergeAllowed := i.mergeWindow > 0 && !i.boundary && time.Since(i.lastExecuted) <= i.mergeWindow
+	return i.execute(c, mergeAllowed)
+}
+
+// execute runs the command and, if merge is set, tries to fold it into the
+// last undo step instead of starting a new one
+func (i *CommandInvoker) execute(c Command, merge bool) error {
+	if err := c.Execute(); err != nil {
+		return err
+	}
+	i.merged = merge && i.mergeIntoLast(c)
+	if !i.merged {
+		i.push(c)
+	}
+	// A new command starts a new branch of history
+	i.redoStack = nil
+	i.boundary = false
+	i.lastExecuted = time.Now()
+	return nil
 }
 
-func (i *CommandInvoker) Execute(c Command) {
-	c.Execute()
+func (i *CommandInvoker) push(c Command) {
 	i.history = append(i.history, c)
+	if i.maxHistory > 0 && len(i.history) > i.maxHistory {
+		dropped := len(i.history) - i.maxHistory
+		i.history = append(i.history[:0], i.history[dropped:]...)
+	}
 }
 
-func (i *CommandInvoker) Undo() {
+func (i *CommandInvoker) Undo() error {
 	if len(i.history) > 0 {
 		lastCommand := i.history[len(i.history)-1]
-		lastCommand.Unexecute()
+		if err := lastCommand.Unexecute(); err != nil {
+			return err
+		}
 		i.history = i.history[:len(i.history)-1]
+		i.redoStack = append(i.redoStack, lastCommand)
+		i.boundary = true
+	}
+	return nil
+}
+
+func (i *CommandInvoker) Redo() error {
+	if len(i.redoStack) > 0 {
+		lastUndone := i.redoStack[len(i.redoStack)-1]
+		if err := lastUndone.Execute(); err != nil {
+			return err
+		}
+		i.redoStack = i.redoStack[:len(i.redoStack)-1]
+		i.push(lastUndone)
+		i.boundary = true
 	}
+	return nil
+}
+
+func (i *CommandInvoker) CanUndo() bool {
+	return len(i.history) > 0
+}
+
+func (i *CommandInvoker) CanRedo() bool {
+	return len(i.redoStack) > 0
 }
 
 func main() {
+	repl := flag.Bool("repl", false, "read editor commands from standard input")
+	flag.Parse()
+	if *repl {
+		r := NewREPL(&TextEditor{}, NewCommandInvoker(1000), os.Stdout)
+		if err := r.Run(os.Stdin); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	editor := &TextEditor{}
-	invoker := &CommandInvoker{}
+	invoker := NewCommandInvoker(100)
 
 	addCommand1 := &AddTextCommand{editor: editor, text: "Hello, "}
 	invoker.Execute(addCommand1)
@@ -73,4 +222,126 @@ func main() {
 
 	invoker.Undo()
 	editor.Display() // Output: Hello,
+
+	invoker.Redo()
+	editor.Display() // Output: Hello, world!
+
+	fmt.Println(invoker.CanUndo(), invoker.CanRedo()) // Output: true false
+
+	// Editing in the middle of multibyte text
+	invoker.Execute(&ReplaceCommand{editor: editor, start: 7, end: 12, text: "世界"})
+	editor.Display() // Output: Hello, 世界!
+
+	invoker.Execute(&InsertTextCommand{editor: editor, pos: 9, text: " 🌍"})
+	editor.Display() // Output: Hello, 世界 🌍!
+
+	invoker.Execute(&DeleteRangeCommand{editor: editor, start: 0, end: 7})
+	editor.Display() // Output: 世界 🌍!
+
+	invoker.Undo()
+	invoker.Undo()
+	invoker.Undo()
+	editor.Display() // Output: Hello, world!
+
+	// Grouping commands into a single undo step that is rolled back if any step fails
+	rename := NewMacroCommand(
+		&ReplaceCommand{editor: editor, start: 0, end: 5, text: "Goodbye"},
+		&DeleteRangeCommand{editor: editor, start: 20, end: 30},
+	)
+	if err := invoker.Execute(rename); err != nil {
+		fmt.Println("Error:", err)
+	}
+	editor.Display() // Output: Hello, world!
+
+	invoker.Execute(NewMacroCommand(
+		&ReplaceCommand{editor: editor, start: 0, end: 5, text: "Goodbye"},
+		&ReplaceCommand{editor: editor, start: 9, end: 14, text: "moon"},
+	))
+	editor.Display() // Output: Goodbye, moon!
+
+	invoker.Undo()
+	editor.Display() // Output: Hello, world!
+
+	// Coalescing typed characters into a single undo step
+	typing := NewCommandInvoker(100)
+	typing.SetMergeWindow(time.Second)
+	for _, r := range " How are you?" {
+		typing.Execute(&AddTextCommand{editor: editor, text: string(r)})
+	}
+	typing.MarkUndoBoundary()
+	typing.Execute(&AddTextCommand{editor: editor, text: " Fine."})
+	editor.Display() // Output: Hello, world! How are you? Fine.
+
+	typing.Undo()
+	editor.Display() // Output: Hello, world! How are you?
+
+	typing.Undo()
+	editor.Display() // Output: Hello, world!
+
+	// Letting several goroutines edit the same document through a single executor
+	shared := &TextEditor{}
+	async := NewAsyncInvoker(NewCommandInvoker(100), 16)
+	var wg sync.WaitGroup
+	for _, word := range []string{"alpha ", "beta ", "gamma "} {
+		wg.Add(1)
+		go func(word string) {
+			defer wg.Done()
+			if err := async.Submit(context.Background(), &AddTextCommand{editor: shared, text: word}).Wait(context.Background()); err != nil {
+				fmt.Println("Error:", err)
+			}
+		}(word)
+	}
+	wg.Wait()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	fmt.Println(async.Submit(cancelled, &AddTextCommand{editor: shared, text: "never"}).Wait(context.Background())) // Output: context canceled
+
+	var length int
+	async.Do(context.Background(), func() error {
+		length = shared.Len()
+		return nil
+	}).Wait(context.Background())
+	async.Close()
+	fmt.Println(length) // Output: 17
+
+	// Two users editing the same document at the same time
+	server := NewServer("Hello, world!")
+	aliceEditor, bobEditor := &TextEditor{}, &TextEditor{}
+	alice := server.Connect("alice", aliceEditor)
+	bob := server.Connect("bob", bobEditor)
+
+	alice.Execute(&ReplaceCommand{editor: aliceEditor, start: 7, end: 12, text: "there"})
+	bob.Execute(&InsertTextCommand{editor: bobEditor, pos: 5, text: " again"})
+	alice.Sync()
+	bob.Sync()
+	fmt.Println(alice.Text()) // Output: Hello again, there!
+	fmt.Println(bob.Text())   // Output: Hello again, there!
+
+	// Recording commands in a journal and rebuilding the editor from it after a restart
+	dir, err := os.MkdirTemp("", "editor")
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	journaled := &TextEditor{}
+	journal, err := OpenJournal(dir, journaled, NewCommandInvoker(100), 1000)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	journal.Execute(&AddTextCommand{editor: journaled, text: "Saved, "})
+	journal.Execute(&AddTextCommand{editor: journaled, text: "and restored."})
+	journal.Close()
+
+	restored := &TextEditor{}
+	journal, err = OpenJournal(dir, restored, NewCommandInvoker(100), 1000)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer journal.Close()
+	restored.Display() // Output: Saved, and restored.
 }
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrLengthMismatch = errors.New("operation does not match document length")
+
+type componentKind int
+
+const (
+	retainKind componentKind = iota
+	insertKind
+	deleteKind
+)
+
+type component struct {
+	kind componentKind
+	n    int    // runes to retain or delete
+	text []rune // runes to insert
+}
+
+func (c component) length() int {
+	if c.kind == insertKind {
+		return len(c.text)
+	}
+	return c.n
+}
+
+// Operation describes an edit of a whole document as a sequence of retained,
+// inserted and deleted runes, so that concurrent edits can be transformed
+// against each other. Lengths count runes.
+type Operation struct {
+	components []component
+	BaseLen    int // length of the document the operation applies to
+	TargetLen  int // length of the document afterwards
+}
+
+func (o *Operation) Retain(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.BaseLen += n
+	o.TargetLen += n
+	if last := len(o.components) - 1; last >= 0 && o.components[last].kind == retainKind {
+		o.components[last].n += n
+		return o
+	}
+	o.components = append(o.components, component{kind: retainKind, n: n})
+	return o
+}
+
+func (o *Operation) Insert(s string) *Operation {
+	return o.insert([]rune(s))
+}
+
+func (o *Operation) insert(text []rune) *Operation {
+	if len(text) == 0 {
+		return o
+	}
+	o.TargetLen += len(text)
+	last := len(o.components) - 1
+	switch {
+	case last >= 0 && o.components[last].kind == insertKind:
+		o.components[last].text = append(o.components[last].text[:len(o.components[last].text):len(o.components[last].text)], text...)
+	case last >= 0 && o.components[last].kind == deleteKind:
+		// Keep inserts before deletes so equal operations have equal components
+		if last >= 1 && o.components[last-1].kind == insertKind {
+			prev := o.components[last-1].text
+			o.components[last-1].text = append(prev[:len(prev):len(prev)], text...)
+		} else {
+			o.components = append(o.components, o.components[last])
+			o.components[last] = component{kind: insertKind, text: text}
+		}
+	default:
+		o.components = append(o.components, component{kind: insertKind, text: text})
+	}
+	return o
+}
+
+func (o *Operation) Delete(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.BaseLen += n
+	if last := len(o.components) - 1; last >= 0 && o.components[last].kind == deleteKind {
+		o.components[last].n += n
+		return o
+	}
+	o.components = append(o.components, component{kind: deleteKind, n: n})
+	return o
+}
+
+// Apply returns text with the operation applied
+func (o Operation) Apply(text string) (string, error) {
+	src := []rune(text)
+	if len(src) != o.BaseLen {
+		return "", fmt.Errorf("apply to %d runes, want %d: %w", len(src), o.BaseLen, ErrLengthMismatch)
+	}
+	dst := make([]rune, 0, o.TargetLen)
+	pos := 0
+	for _, c := range o.components {
+		switch c.kind {
+		case retainKind:
+			dst = append(dst, src[pos:pos+c.n]...)
+			pos += c.n
+		case insertKind:
+			dst = append(dst, c.text...)
+		case deleteKind:
+			pos += c.n
+		}
+	}
+	return string(dst), nil
+}
+
+// ApplyTo performs the operation on an editor, keeping its cursor on the same text
+func (o Operation) ApplyTo(editor *TextEditor) error {
+	if editor.Len() != o.BaseLen {
+		return fmt.Errorf("apply to %d runes, want %d: %w", editor.Len(), o.BaseLen, ErrLengthMismatch)
+	}
+	cursor := o.TransformIndex(editor.Cursor())
+	pos := 0
+	for _, c := range o.components {
+		switch c.kind {
+		case retainKind:
+			pos += c.n
+		case insertKind:
+			if err := editor.InsertAt(pos, string(c.text)); err != nil {
+				return err
+			}
+			pos += len(c.text)
+		case deleteKind:
+			if _, err := editor.DeleteRange(pos, pos+c.n); err != nil {
+				return err
+			}
+		}
+	}
+	return editor.MoveCursor(cursor)
+}
+
+// TransformIndex maps a position in the original document to the edited one
+func (o Operation) TransformIndex(index int) int {
+	newIndex := index
+	for _, c := range o.components {
+		switch c.kind {
+		case retainKind:
+			index -= c.n
+		case insertKind:
+			newIndex += len(c.text)
+		case deleteKind:
+			newIndex -= min(index, c.n)
+			index -= c.n
+		}
+		if index < 0 {
+			break
+		}
+	}
+	return newIndex
+}
+
+// cursor walks the components of an operation, splitting them as needed
+type cursor struct {
+	components []component
+	current    *component
+}
+
+func newCursor(o Operation) *cursor {
+	c := &cursor{components: o.components}
+	c.next()
+	return c
+}
+
+func (c *cursor) next() {
+	if len(c.components) == 0 {
+		c.current = nil
+		return
+	}
+	current := c.components[0]
+	c.current = &current
+	c.components = c.components[1:]
+}
+
+// take consumes n runes of the current component
+func (c *cursor) take(n int) {
+	if n >= c.current.length() {
+		c.next()
+		return
+	}
+	if c.current.kind == insertKind {
+		c.current.text = c.current.text[n:]
+	} else {
+		c.current.n -= n
+	}
+}
+
+// Compose returns a single operation with the effect of a followed by b
+func Compose(a, b Operation) (Operation, error) {
+	if a.TargetLen != b.BaseLen {
+		return Operation{}, fmt.Errorf("compose: %w", ErrLengthMismatch)
+	}
+	var out Operation
+	ca, cb := newCursor(a), newCursor(b)
+	for ca.current != nil || cb.current != nil {
+		if ca.current != nil && ca.current.kind == deleteKind {
+			out.Delete(ca.current.n)
+			ca.next()
+			continue
+		}
+		if cb.current != nil && cb.current.kind == insertKind {
+			out.insert(cb.current.text)
+			cb.next()
+			continue
+		}
+		if ca.current == nil || cb.current == nil {
+			return Operation{}, fmt.Errorf("compose: %w", ErrLengthMismatch)
+		}
+		n := min(ca.current.length(), cb.current.length())
+		switch {
+		case ca.current.kind == retainKind && cb.current.kind == retainKind:
+			out.Retain(n)
+		case ca.current.kind == insertKind && cb.current.kind == retainKind:
+			out.insert(ca.current.text[:n])
+		case ca.current.kind == retainKind && cb.current.kind == deleteKind:
+			out.Delete(n)
+		}
+		// An insert in a that b deletes leaves no trace
+		ca.take(n)
+		cb.take(n)
+	}
+	return out, nil
+}
+
+// Transform takes two operations made concurrently on the same document and
+// returns a' and b' such that applying a then b' gives the same result as
+// applying b then a'. When both insert at the same position, a's text comes first.
+func Transform(a, b Operation) (Operation, Operation, error) {
+	if a.BaseLen != b.BaseLen {
+		return Operation{}, Operation{}, fmt.Errorf("transform: %w", ErrLengthMismatch)
+	}
+	var aPrime, bPrime Operation
+	ca, cb := newCursor(a), newCursor(b)
+	for ca.current != nil || cb.current != nil {
+		if ca.current != nil && ca.current.kind == insertKind {
+			aPrime.insert(ca.current.text)
+			bPrime.Retain(len(ca.current.text))
+			ca.next()
+			continue
+		}
+		if cb.current != nil && cb.current.kind == insertKind {
+			aPrime.Retain(len(cb.current.text))
+			bPrime.insert(cb.current.text)
+			cb.next()
+			continue
+		}
+		if ca.current == nil || cb.current == nil {
+			return Operation{}, Operation{}, fmt.Errorf("transform: %w", ErrLengthMismatch)
+		}
+		n := min(ca.current.n, cb.current.n)
+		switch {
+		case ca.current.kind == retainKind && cb.current.kind == retainKind:
+			aPrime.Retain(n)
+			bPrime.Retain(n)
+		case ca.current.kind == deleteKind && cb.current.kind == retainKind:
+			aPrime.Delete(n)
+		case ca.current.kind == retainKind && cb.current.kind == deleteKind:
+			bPrime.Delete(n)
+		}
+		// Text deleted by both operations needs deleting only once
+		ca.take(n)
+		cb.take(n)
+	}
+	return aPrime, bPrime, nil
+}
+
+// OperationFor describes what a text command will do to a document of the given length
+func OperationFor(c Command, length int) (Operation, error) {
+	var o Operation
+	switch c := c.(type) {
+	case *AddTextCommand:
+		o.Retain(length).Insert(c.text)
+	case *InsertTextCommand:
+		if c.pos < 0 || c.pos > length {
+			return o, fmt.Errorf("insert at %d: %w", c.pos, ErrOutOfRange)
+		}
+		o.Retain(c.pos).Insert(c.text).Retain(length - c.pos)
+	case *DeleteRangeCommand:
+		if c.start < 0 || c.end < c.start || c.end > length {
+			return o, fmt.Errorf("delete [%d, %d): %w", c.start, c.end, ErrOutOfRange)
+		}
+		o.Retain(c.start).Delete(c.end - c.start).Retain(length - c.end)
+	case *ReplaceCommand:
+		if c.start < 0 || c.end < c.start || c.end > length {
+			return o, fmt.Errorf("replace [%d, %d): %w", c.start, c.end, ErrOutOfRange)
+		}
+		o.Retain(c.start).Delete(c.end - c.start).Insert(c.text).Retain(length - c.end)
+	case *MoveCursorCommand:
+		o.Retain(length)
+	case *MacroCommand:
+		o.Retain(length)
+		for _, step := range c.commands {
+			next, err := OperationFor(step, o.TargetLen)
+			if err != nil {
+				return Operation{}, err
+			}
+			if o, err = Compose(o, next); err != nil {
+				return Operation{}, err
+			}
+		}
+	default:
+		return o, fmt.Errorf("no operation for %T", c)
+	}
+	return o, nil
+}
+
+func (o Operation) String() string {
+	parts := make([]string, len(o.components))
+	for i, c := range o.components {
+		switch c.kind {
+		case retainKind:
+			parts[i] = fmt.Sprintf("retain(%d)", c.n)
+		case insertKind:
+			parts[i] = fmt.Sprintf("insert(%q)", string(c.text))
+		case deleteKind:
+			parts[i] = fmt.Sprintf("delete(%d)", c.n)
+		}
+	}
+	return strings.Join(parts, " ")
+}
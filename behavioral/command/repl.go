@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const replHelp = `Commands:
+  add <text>                     append text
+  insert <pos> <text>            insert text at a position
+  delete <start> <end>           delete the text between two positions
+  replace <start> <end> <text>   replace the text between two positions
+  move <pos>                     move the cursor
+  undo, redo                     undo or redo the last command
+  history                        list the commands that can be undone
+  show                           print the text and cursor position
+  save <file>, load <file>       write the text to a file or read it back
+  help, quit
+Text may be quoted with Go syntax to keep leading spaces or escapes, e.g. add " world\n".`
+
+// REPL is a line-oriented client of the text editor. Every editing line
+// becomes a command executed through the invoker.
+type REPL struct {
+	editor  *TextEditor
+	invoker *CommandInvoker
+	out     io.Writer
+}
+
+func NewREPL(editor *TextEditor, invoker *CommandInvoker, out io.Writer) *REPL {
+	return &REPL{editor: editor, invoker: invoker, out: out}
+}
+
+// ErrFailedLines is returned by Run when some lines could not be run
+var ErrFailedLines = errors.New("lines failed")
+
+// Run reads commands from in until it is exhausted or "quit" is read. A line
+// that fails is reported and the next one is read, so that a script runs to
+// the end, but Run then returns an error wrapping ErrFailedLines.
+func (r *REPL) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	run, failed := 0, 0
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == "quit" || line == "exit" {
+			break
+		}
+		run++
+		if err := r.Eval(line); err != nil {
+			fmt.Fprintf(r.out, "error: line %d: %v\n", n, err)
+			failed++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("repl: %w: %d of %d", ErrFailedLines, failed, run)
+	}
+	return nil
+}
+
+// Eval runs a single line
+func (r *REPL) Eval(line string) error {
+	name, args, _ := strings.Cut(line, " ")
+	args = strings.TrimSpace(args)
+	switch name {
+	case "add":
+		text, err := parseText(args)
+		if err != nil {
+			return err
+		}
+		return r.execute(&AddTextCommand{editor: r.editor, text: text})
+	case "insert":
+		nums, rest, err := parseInts(args, 1)
+		if err != nil {
+			return err
+		}
+		text, err := parseText(rest)
+		if err != nil {
+			return err
+		}
+		return r.execute(&InsertTextCommand{editor: r.editor, pos: nums[0], text: text})
+	case "delete":
+		nums, _, err := parseInts(args, 2)
+		if err != nil {
+			return err
+		}
+		return r.execute(&DeleteRangeCommand{editor: r.editor, start: nums[0], end: nums[1]})
+	case "replace":
+		nums, rest, err := parseInts(args, 2)
+		if err != nil {
+			return err
+		}
+		text, err := parseText(rest)
+		if err != nil {
+			return err
+		}
+		return r.execute(&ReplaceCommand{editor: r.editor, start: nums[0], end: nums[1], text: text})
+	case "move":
+		nums, _, err := parseInts(args, 1)
+		if err != nil {
+			return err
+		}
+		return r.execute(&MoveCursorCommand{editor: r.editor, pos: nums[0]})
+	case "undo":
+		if !r.invoker.CanUndo() {
+			return errors.New("nothing to undo")
+		}
+		return r.then(r.invoker.Undo())
+	case "redo":
+		if !r.invoker.CanRedo() {
+			return errors.New("nothing to redo")
+		}
+		return r.then(r.invoker.Redo())
+	case "history":
+		for i, c := range r.invoker.history {
+			fmt.Fprintf(r.out, "%d: %s\n", i+1, describe(c))
+		}
+		return nil
+	case "show":
+		return r.then(nil)
+	case "save":
+		if args == "" {
+			return errors.New("usage: save <file>")
+		}
+		return os.WriteFile(args, []byte(r.editor.Text()), 0o644)
+	case "load":
+		if args == "" {
+			return errors.New("usage: load <file>")
+		}
+		data, err := os.ReadFile(args)
+		if err != nil {
+			return err
+		}
+		// Loading replaces the whole text, so it can be undone like any other edit
+		return r.execute(&ReplaceCommand{editor: r.editor, start: 0, end: r.editor.Len(), text: string(data)})
+	case "help":
+		fmt.Fprintln(r.out, replHelp)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q, type help for a list", name)
+}
+
+func (r *REPL) execute(c Command) error {
+	return r.then(r.invoker.Execute(c))
+}
+
+// then prints the text after a successful command
+func (r *REPL) then(err error) error {
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "%q (cursor %d)\n", r.editor.Text(), r.editor.Cursor())
+	return nil
+}
+
+// parseInts reads n integers from the front of args and returns the rest
+func parseInts(args string, n int) ([]int, string, error) {
+	nums := make([]int, n)
+	for i := range nums {
+		var field string
+		field, args, _ = strings.Cut(strings.TrimSpace(args), " ")
+		num, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, "", fmt.Errorf("expected a position, got %q", field)
+		}
+		nums[i] = num
+	}
+	return nums, strings.TrimSpace(args), nil
+}
+
+func parseText(args string) (string, error) {
+	if strings.HasPrefix(args, `"`) {
+		return strconv.Unquote(args)
+	}
+	return args, nil
+}
+
+func describe(c Command) string {
+	switch c := c.(type) {
+	case *AddTextCommand:
+		return fmt.Sprintf("add %q", c.text)
+	case *InsertTextCommand:
+		return fmt.Sprintf("insert %d %q", c.pos, c.text)
+	case *DeleteRangeCommand:
+		return fmt.Sprintf("delete %d %d", c.start, c.end)
+	case *ReplaceCommand:
+		return fmt.Sprintf("replace %d %d %q", c.start, c.end, c.text)
+	case *MoveCursorCommand:
+		return fmt.Sprintf("move %d", c.pos)
+	case *MacroCommand:
+		steps := make([]string, len(c.commands))
+		for i, step := range c.commands {
+			steps[i] = describe(step)
+		}
+		return "macro [" + strings.Join(steps, "; ") + "]"
+	}
+	return fmt.Sprintf("%T", c)
+}
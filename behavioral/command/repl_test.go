@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestREPLRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     string
+		wantText   string
+		wantFailed string // in the error returned by Run, empty for none
+		wantOutput []string
+	}{
+		{
+			name:       "editing and undo",
+			script:     "add Hello\nadd \", world!\"\ninsert 5 \" there\"\nundo\nhistory\n",
+			wantText:   "Hello, world!",
+			wantOutput: []string{`"Hello there, world!" (cursor 11)`, `2: add ", world!"`},
+		},
+		{
+			name:       "comments and blank lines",
+			script:     "# a comment\n\n   \nadd x\nshow",
+			wantText:   "x",
+			wantOutput: []string{`"x" (cursor 0)`},
+		},
+		{
+			name:       "failing lines do not stop the script",
+			script:     "add abc\ndelete 2 9\nfrobnicate\nredo\nadd d",
+			wantText:   "abcd",
+			wantFailed: "3 of 5",
+			wantOutput: []string{"error: line 2: delete", `error: line 3: unknown command "frobnicate"`, "error: line 4: nothing to redo"},
+		},
+		{
+			name:       "quit stops reading",
+			script:     "add a\nmove 7\nquit\nadd b\nfrobnicate",
+			wantText:   "a",
+			wantFailed: "1 of 2",
+			wantOutput: []string{"error: line 2: move"},
+		},
+		{
+			name:       "bad arguments",
+			script:     "insert x y\nadd \"unterminated\nreplace 0",
+			wantFailed: "3 of 3",
+			wantOutput: []string{`error: line 1: expected a position, got "x"`, "error: line 2:", "error: line 3:"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor := &TextEditor{}
+			var out strings.Builder
+			err := NewREPL(editor, NewCommandInvoker(0), &out).Run(strings.NewReader(tt.script))
+			if tt.wantFailed == "" {
+				if err != nil {
+					t.Fatalf("Run = %v\n%s", err, out.String())
+				}
+			} else if !errors.Is(err, ErrFailedLines) || !strings.HasSuffix(err.Error(), tt.wantFailed) {
+				t.Fatalf("Run = %v, want ErrFailedLines for %s lines\n%s", err, tt.wantFailed, out.String())
+			}
+			if got := editor.Text(); got != tt.wantText {
+				t.Errorf("text = %q, want %q", got, tt.wantText)
+			}
+			for _, want := range tt.wantOutput {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output does not contain %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestREPLSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "text.txt")
+	editor := &TextEditor{}
+	var out strings.Builder
+	script := "add saved\nsave " + path + "\nadd \" and more\"\nload " + path + "\nundo\nload " + path + ".missing\n"
+	err := NewREPL(editor, NewCommandInvoker(0), &out).Run(strings.NewReader(script))
+	if !errors.Is(err, ErrFailedLines) {
+		t.Fatalf("Run = %v, want the missing file to fail", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "saved" {
+		t.Fatalf("saved %q, %v", data, err)
+	}
+	// The load was undone
+	if got := editor.Text(); got != "saved and more" {
+		t.Errorf("text = %q, want %q", got, "saved and more")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// SerializableCommand is a Command that can be written to a journal and read back
+type SerializableCommand interface {
+	Command
+	MarshalCommand() (json.RawMessage, error)
+	UnmarshalCommand(editor *TextEditor, data json.RawMessage) error
+}
+
+var (
+	commandFactories = map[string]func() SerializableCommand{}
+	commandNames     = map[reflect.Type]string{}
+)
+
+// RegisterCommand makes a command type known to the journal under name
+func RegisterCommand(name string, factory func() SerializableCommand) {
+	commandFactories[name] = factory
+	commandNames[reflect.TypeOf(factory())] = name
+}
+
+func init() {
+	RegisterCommand("add", func() SerializableCommand { return &AddTextCommand{} })
+	RegisterCommand("insert", func() SerializableCommand { return &InsertTextCommand{} })
+	RegisterCommand("delete", func() SerializableCommand { return &DeleteRangeCommand{} })
+	RegisterCommand("replace", func() SerializableCommand { return &ReplaceCommand{} })
+	RegisterCommand("move", func() SerializableCommand { return &MoveCursorCommand{} })
+	RegisterCommand("macro", func() SerializableCommand { return &MacroCommand{} })
+}
+
+// encodedCommand is a command tagged with its registered type name
+type encodedCommand struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func encodeCommand(c Command) (encodedCommand, error) {
+	sc, ok := c.(SerializableCommand)
+	name, registered := commandNames[reflect.TypeOf(c)]
+	if !ok || !registered {
+		return encodedCommand{}, fmt.Errorf("command %T is not registered", c)
+	}
+	data, err := sc.MarshalCommand()
+	if err != nil {
+		return encodedCommand{}, fmt.Errorf("encode %s: %w", name, err)
+	}
+	return encodedCommand{Type: name, Data: data}, nil
+}
+
+func decodeCommand(editor *TextEditor, e encodedCommand) (Command, error) {
+	factory, ok := commandFactories[e.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown command type %q", e.Type)
+	}
+	c := factory()
+	if err := c.UnmarshalCommand(editor, e.Data); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", e.Type, err)
+	}
+	return c, nil
+}
+
+type textData struct {
+	Pos   int    `json:"pos,omitempty"`
+	Start int    `json:"start,omitempty"`
+	End   int    `json:"end,omitempty"`
+	Text  string `json:"text,omitempty"`
+}
+
+func (c *AddTextCommand) MarshalCommand() (json.RawMessage, error) {
+	return json.Marshal(textData{Text: c.text})
+}
+
+func (c *AddTextCommand) UnmarshalCommand(editor *TextEditor, data json.RawMessage) error {
+	var d textData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+	*c = AddTextCommand{editor: editor, text: d.Text}
+	return nil
+}
+
+func (c *InsertTextCommand) MarshalCommand() (json.RawMessage, error) {
+	return json.Marshal(textData{Pos: c.pos, Text: c.text})
+}
+
+func (c *InsertTextCommand) UnmarshalCommand(editor *TextEditor, data json.RawMessage) error {
+	var d textData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+	*c = InsertTextCommand{editor: editor, pos: d.Pos, text: d.Text}
+	return nil
+}
+
+func (c *DeleteRangeCommand) MarshalCommand() (json.RawMessage, error) {
+	return json.Marshal(textData{Start: c.start, End: c.end})
+}
+
+func (c *DeleteRangeCommand) UnmarshalCommand(editor *TextEditor, data json.RawMessage) error {
+	var d textData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+	*c = DeleteRangeCommand{editor: editor, start: d.Start, end: d.End}
+	return nil
+}
+
+func (c *ReplaceCommand) MarshalCommand() (json.RawMessage, error) {
+	return json.Marshal(textData{Start: c.start, End: c.end, Text: c.text})
+}
+
+func (c *ReplaceCommand) UnmarshalCommand(editor *TextEditor, data json.RawMessage) error {
+	var d textData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+	*c = ReplaceCommand{editor: editor, start: d.Start, end: d.End, text: d.Text}
+	return nil
+}
+
+func (c *MoveCursorCommand) MarshalCommand() (json.RawMessage, error) {
+	return json.Marshal(textData{Pos: c.pos})
+}
+
+func (c *MoveCursorCommand) UnmarshalCommand(editor *TextEditor, data json.RawMessage) error {
+	var d textData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+	*c = MoveCursorCommand{editor: editor, pos: d.Pos}
+	return nil
+}
+
+func (m *MacroCommand) MarshalCommand() (json.RawMessage, error) {
+	steps := make([]encodedCommand, len(m.commands))
+	for i, c := range m.commands {
+		e, err := encodeCommand(c)
+		if err != nil {
+			return nil, err
+		}
+		steps[i] = e
+	}
+	return json.Marshal(steps)
+}
+
+func (m *MacroCommand) UnmarshalCommand(editor *TextEditor, data json.RawMessage) error {
+	var steps []encodedCommand
+	if err := json.Unmarshal(data, &steps); err != nil {
+		return err
+	}
+	m.commands = make([]Command, len(steps))
+	for i, e := range steps {
+		c, err := decodeCommand(editor, e)
+		if err != nil {
+			return err
+		}
+		m.commands[i] = c
+	}
+	return nil
+}
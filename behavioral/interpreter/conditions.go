@@ -0,0 +1,67 @@
+package main
+
+// NonTerminalExpression: && and ||, which only evaluate the right operand
+// when the left one does not decide the result
+type Logical struct {
+	left, right Expression
+	operator    string
+	pos         int
+}
+
+func (l *Logical) Interpret(env *Environment) (Value, error) {
+	left, err := condition(l.left, env, l.pos, l.operator)
+	if err != nil {
+		return Value{}, err
+	}
+	if left == (l.operator == "||") {
+		return Bool(left), nil
+	}
+	right, err := condition(l.right, env, l.pos, l.operator)
+	if err != nil {
+		return Value{}, err
+	}
+	return Bool(right), nil
+}
+
+// NonTerminalExpression: !operand
+type Not struct {
+	operand Expression
+	pos     int
+}
+
+func (n *Not) Interpret(env *Environment) (Value, error) {
+	value, err := condition(n.operand, env, n.pos, "!")
+	if err != nil {
+		return Value{}, err
+	}
+	return Bool(!value), nil
+}
+
+// NonTerminalExpression: if(cond, then, else) evaluates only the chosen branch
+type If struct {
+	cond, then, otherwise Expression
+	pos                   int
+}
+
+func (i *If) Interpret(env *Environment) (Value, error) {
+	cond, err := condition(i.cond, env, i.pos, "if")
+	if err != nil {
+		return Value{}, err
+	}
+	if cond {
+		return i.then.Interpret(env)
+	}
+	return i.otherwise.Interpret(env)
+}
+
+// condition interprets an expression that must produce a boolean
+func condition(expr Expression, env *Environment, pos int, token string) (bool, error) {
+	value, err := expr.Interpret(env)
+	if err != nil {
+		return false, err
+	}
+	if value.kind != Boolean {
+		return false, &EvalError{Pos: pos, Token: token, Err: ErrNotBoolean}
+	}
+	return value.b, nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Derive returns the derivative of expr with respect to the variable name.
+// Variables are symbols: the tree is differentiated without their values,
+// and other variables are treated as constants. Variables defined with let
+// are replaced by their definitions, so the result is a single expression
+// that can be printed, optimized, compiled or interpreted.
+//
+// Calls are differentiated with the meaning of the built-in functions, and
+// if(c, a, b) piecewise. Comparisons, boolean operators and functions defined
+// with DefineFunc have no derivative.
+func Derive(expr Expression, name string) (Expression, error) {
+	expr, err := inline(expr, nil)
+	if err != nil {
+		return nil, err
+	}
+	d := &deriver{name: name}
+	return d.derive(expr)
+}
+
+// binding is a variable defined with let, in a list from the innermost scope out
+type binding struct {
+	name  string
+	value Expression
+	outer *binding
+}
+
+// inline replaces variables defined with let by their definitions, leaving
+// an expression without statements or blocks
+func inline(expr Expression, scope *binding) (Expression, error) {
+	switch e := expr.(type) {
+	case *Number:
+		return e, nil
+	case *Variable:
+		for b := scope; b != nil; b = b.outer {
+			if b.name == e.name {
+				return b.value, nil
+			}
+		}
+		return e, nil
+	case *Operation:
+		left, right, err := inlinePair(e.left, e.right, scope)
+		if err != nil {
+			return nil, err
+		}
+		return &Operation{left: left, right: right, operator: e.operator, pos: e.pos}, nil
+	case *Logical:
+		left, right, err := inlinePair(e.left, e.right, scope)
+		if err != nil {
+			return nil, err
+		}
+		return &Logical{left: left, right: right, operator: e.operator, pos: e.pos}, nil
+	case *Not:
+		operand, err := inline(e.operand, scope)
+		if err != nil {
+			return nil, err
+		}
+		return &Not{operand: operand, pos: e.pos}, nil
+	case *Call:
+		args := make([]Expression, len(e.args))
+		for i, arg := range e.args {
+			var err error
+			if args[i], err = inline(arg, scope); err != nil {
+				return nil, err
+			}
+		}
+		return &Call{name: e.name, args: args, pos: e.pos}, nil
+	case *If:
+		cond, err := inline(e.cond, scope)
+		if err != nil {
+			return nil, err
+		}
+		then, otherwise, err := inlinePair(e.then, e.otherwise, scope)
+		if err != nil {
+			return nil, err
+		}
+		return &If{cond: cond, then: then, otherwise: otherwise, pos: e.pos}, nil
+	case *Let:
+		return inline(e.value, scope)
+	case *Program:
+		var result Expression = &Number{}
+		for _, statement := range e.statements {
+			var err error
+			if result, err = inline(statement, scope); err != nil {
+				return nil, err
+			}
+			if let, ok := statement.(*Let); ok {
+				scope = &binding{name: let.name, value: result, outer: scope}
+			}
+		}
+		return result, nil
+	case *Block:
+		return inline(e.body, scope)
+	}
+	return nil, fmt.Errorf("derive %T: %w", expr, ErrNotDifferentiable)
+}
+
+func inlinePair(a, b Expression, scope *binding) (Expression, Expression, error) {
+	a, err := inline(a, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err = inline(b, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, b, nil
+}
+
+type deriver struct {
+	name string
+}
+
+func (d *deriver) derive(expr Expression) (Expression, error) {
+	switch e := expr.(type) {
+	case *Number:
+		if e.value.kind == Boolean {
+			return nil, notDifferentiable(e.String(), e.pos)
+		}
+		return &Number{value: Int(0), pos: e.pos}, nil
+	case *Variable:
+		if e.name == d.name {
+			return &Number{value: Int(1), pos: e.pos}, nil
+		}
+		return &Number{value: Int(0), pos: e.pos}, nil
+	case *Operation:
+		return d.operation(e)
+	case *Call:
+		return d.call(e)
+	case *If:
+		then, err := d.derive(e.then)
+		if err != nil {
+			return nil, err
+		}
+		otherwise, err := d.derive(e.otherwise)
+		if err != nil {
+			return nil, err
+		}
+		return &If{cond: e.cond, then: then, otherwise: otherwise, pos: e.pos}, nil
+	case *Logical:
+		return nil, notDifferentiable(e.operator, e.pos)
+	case *Not:
+		return nil, notDifferentiable("!", e.pos)
+	}
+	return nil, fmt.Errorf("derive %T: %w", expr, ErrNotDifferentiable)
+}
+
+func (d *deriver) operation(o *Operation) (Expression, error) {
+	switch o.operator {
+	case "+", "-", "*", "/":
+	default:
+		return nil, notDifferentiable(o.operator, o.pos)
+	}
+	u, v := o.left, o.right
+	du, err := d.derive(u)
+	if err != nil {
+		return nil, err
+	}
+	dv, err := d.derive(v)
+	if err != nil {
+		return nil, err
+	}
+	b := builder{pos: o.pos}
+	switch o.operator {
+	case "+":
+		return b.add(du, dv), nil
+	case "-":
+		return b.sub(du, dv), nil
+	case "*":
+		// (uv)' = u'v + uv'
+		return b.add(b.mul(du, v), b.mul(u, dv)), nil
+	}
+	// (u/v)' = (u'v - uv') / v²
+	return b.div(b.sub(b.mul(du, v), b.mul(u, dv)), b.mul(v, v)), nil
+}
+
+// Built-in functions with a derivative, by the number of arguments they take;
+// 0 means any number but at least one
+var derivableFunctions = map[string]int{
+	"abs": 1, "pow": 2, "sqrt": 1, "exp": 1, "ln": 1, "sin": 1, "cos": 1, "tan": 1, "min": 0, "max": 0,
+}
+
+func (d *deriver) call(c *Call) (Expression, error) {
+	n, ok := derivableFunctions[c.name]
+	if !ok {
+		return nil, notDifferentiable(c.name, c.pos)
+	}
+	if len(c.args) == 0 || (n != 0 && n != len(c.args)) {
+		return nil, fmt.Errorf("derive %s at %d: %w", c.name, c.pos, ErrArgumentCount)
+	}
+	// args holds the derivatives of the arguments
+	args := make([]Expression, len(c.args))
+	for i, arg := range c.args {
+		var err error
+		if args[i], err = d.derive(arg); err != nil {
+			return nil, err
+		}
+	}
+	b := builder{pos: c.pos}
+	call := func(name string, args ...Expression) Expression {
+		return &Call{name: name, args: args, pos: c.pos}
+	}
+	switch c.name {
+	case "sqrt":
+		return b.div(args[0], b.mul(b.number(2), c)), nil
+	case "exp":
+		return b.mul(c, args[0]), nil
+	case "ln":
+		return b.div(args[0], c.args[0]), nil
+	case "sin":
+		return b.mul(call("cos", c.args[0]), args[0]), nil
+	case "cos":
+		return b.neg(b.mul(call("sin", c.args[0]), args[0])), nil
+	case "tan":
+		cos := call("cos", c.args[0])
+		return b.div(args[0], b.mul(cos, cos)), nil
+	case "abs":
+		negative := &Operation{left: c.args[0], right: b.number(0), operator: "<", pos: c.pos}
+		return &If{cond: negative, then: b.neg(args[0]), otherwise: args[0], pos: c.pos}, nil
+	case "pow":
+		u, v := c.args[0], c.args[1]
+		du, dv := args[0], args[1]
+		if isNumber(dv, 0) {
+			// (u^n)' = n u^(n-1) u'
+			return b.mul(b.mul(v, call("pow", u, b.sub(v, b.number(1)))), du), nil
+		}
+		if isNumber(du, 0) {
+			// (a^v)' = a^v ln(a) v'
+			return b.mul(b.mul(c, call("ln", u)), dv), nil
+		}
+		// (u^v)' = u^v (v' ln(u) + v u' / u)
+		return b.mul(c, b.add(b.mul(dv, call("ln", u)), b.div(b.mul(v, du), u))), nil
+	case "min", "max":
+		if len(args) == 1 {
+			return args[0], nil
+		}
+		// min(a, rest...) is a where a <= min(rest...), and min(rest...) elsewhere
+		rest := Expression(&Call{name: c.name, args: c.args[1:], pos: c.pos})
+		if len(c.args) == 2 {
+			rest = c.args[1]
+		}
+		drest, err := d.derive(rest)
+		if err != nil {
+			return nil, err
+		}
+		operator := "<="
+		if c.name == "max" {
+			operator = ">="
+		}
+		first := &Operation{left: c.args[0], right: rest, operator: operator, pos: c.pos}
+		return &If{cond: first, then: args[0], otherwise: drest, pos: c.pos}, nil
+	}
+	return nil, notDifferentiable(c.name, c.pos)
+}
+
+func notDifferentiable(token string, pos int) error {
+	return fmt.Errorf("derive %s at %d: %w", token, pos, ErrNotDifferentiable)
+}
+
+// builder makes arithmetic nodes, leaving out terms that are known to vanish
+// so that derivatives stay readable
+type builder struct {
+	pos int
+}
+
+func (b builder) number(n int64) Expression {
+	return &Number{value: Int(n), pos: b.pos}
+}
+
+func (b builder) add(x, y Expression) Expression {
+	switch {
+	case isNumber(x, 0):
+		return y
+	case isNumber(y, 0):
+		return x
+	}
+	if negated, ok := negation(y); ok {
+		return b.sub(x, negated)
+	}
+	return b.operation(x, y, "+")
+}
+
+func (b builder) sub(x, y Expression) Expression {
+	switch {
+	case isNumber(y, 0):
+		return x
+	case isNumber(x, 0):
+		return b.neg(y)
+	}
+	return b.operation(x, y, "-")
+}
+
+func (b builder) mul(x, y Expression) Expression {
+	switch {
+	case isNumber(x, 0) || isNumber(y, 0):
+		return b.number(0)
+	case isNumber(x, 1):
+		return y
+	case isNumber(y, 1):
+		return x
+	case isNumber(x, -1):
+		return b.neg(y)
+	case isNumber(y, -1):
+		return b.neg(x)
+	}
+	return b.operation(x, y, "*")
+}
+
+func (b builder) div(x, y Expression) Expression {
+	switch {
+	case isNumber(x, 0):
+		return b.number(0)
+	case isNumber(y, 1):
+		return x
+	}
+	return b.operation(x, y, "/")
+}
+
+func (b builder) neg(x Expression) Expression {
+	if negated, ok := negation(x); ok {
+		return negated
+	}
+	return b.operation(b.number(0), x, "-")
+}
+
+// negation returns x for an expression that is -x, the way the parser reads it
+func negation(expr Expression) (Expression, bool) {
+	if o, ok := expr.(*Operation); ok && o.operator == "-" && isNumber(o.left, 0) {
+		return o.right, true
+	}
+	return nil, false
+}
+
+// operation folds operations on two numbers
+func (b builder) operation(x, y Expression, operator string) Expression {
+	o := &Operation{left: x, right: y, operator: operator, pos: b.pos}
+	// Decimal literals are left alone, as their value depends on the numeric mode
+	if x, ok := x.(*Number); ok && x.text == "" {
+		if y, ok := y.(*Number); ok && y.text == "" {
+			if v, err := o.Interpret(nil); err == nil && v.finite() {
+				return &Number{value: v, pos: b.pos}
+			}
+		}
+	}
+	return o
+}
+
+// isNumber reports whether expr is the integer literal n
+func isNumber(expr Expression, n int64) bool {
+	number, ok := expr.(*Number)
+	return ok && number.value.kind == Integer && number.value.BigInt().IsInt64() &&
+		number.value.BigInt().Int64() == n
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// evalAt interprets expr in FloatMode with x and y bound
+func evalAt(t *testing.T, expr Expression, x, y float64) float64 {
+	t.Helper()
+	env := NewEnvironment(nil)
+	env.SetMode(FloatMode)
+	env.Define("x", Float64(x))
+	env.Define("y", Float64(y))
+	v, err := expr.Interpret(env)
+	if err != nil {
+		t.Fatalf("%v at x=%v: %v", expr, x, err)
+	}
+	return v.Float64()
+}
+
+func TestDerive(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string // derivative with respect to x
+	}{
+		{"constant", "5", "0"},
+		{"other variable", "y", "0"},
+		{"negation", "-x", "-1"},
+		{"sum", "3 * x + 2", "3"},
+		{"product", "x * y", "y"},
+		{"product of two factors with x", "x * x", "x + x"},
+		{"quotient", "x / y", "y / (y * y)"},
+		{"reciprocal", "1 / x", "-1 / (x * x)"},
+		{"power with a constant exponent", "pow(x, 3)", "3 * pow(x, 2)"},
+		{"power with a constant base", "pow(2, x)", "pow(2, x) * ln(2)"},
+		{"general power", "pow(x, x)", "pow(x, x) * (ln(x) + x / x)"},
+		{"chain rule through exp", "exp(2 * x)", "exp(2 * x) * 2"},
+		{"chain rule through ln", "ln(x * x)", "(x + x) / (x * x)"},
+		{"chain rule through cos", "cos(3 * x)", "-(sin(3 * x) * 3)"},
+		{"sin", "sin(x)", "cos(x)"},
+		{"tan", "tan(x)", "1 / (cos(x) * cos(x))"},
+		{"sqrt", "sqrt(x)", "1 / (2 * sqrt(x))"},
+		{"abs", "abs(x)", "if(x < 0, -1, 1)"},
+		{"max", "max(x, 0)", "if(x >= 0, 1, 0)"},
+		{"min of three", "min(x, y, 2 * x)", "if(x <= min(y, 2 * x), 1, if(y <= 2 * x, 0, 2))"},
+		{"max of one", "max(x)", "1"},
+		{"if", "if(x > 0, x * x, -x)", "if(x > 0, x + x, -1)"},
+		{"let is inlined", "let t = x * 2; t * t", "2 * (x * 2) + x * 2 * 2"},
+		{"block", "{ let a = 3; a * x }", "3"},
+	}
+	points := []struct{ x, y float64 }{{1.3, 0.7}, {0.4, 2.5}, {-0.8, 1.1}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := (&Context{}).ParseProgram(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			derivative, err := Derive(expr, "x")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := stringOf(derivative); got != tt.want {
+				t.Errorf("Derive(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+			checkPrinted(t, derivative, FloatMode)
+
+			// Compare with a central difference wherever the function is defined
+			const h = 1e-6
+			for _, p := range points {
+				if p.x <= 0 && tt.source != "abs(x)" && tt.source != "if(x > 0, x * x, -x)" {
+					continue // outside the domain of ln, sqrt and pow
+				}
+				want := (evalAt(t, expr, p.x+h, p.y) - evalAt(t, expr, p.x-h, p.y)) / (2 * h)
+				got := evalAt(t, derivative, p.x, p.y)
+				if math.Abs(got-want) > 1e-5*math.Max(1, math.Abs(want)) {
+					t.Errorf("at x=%v, y=%v: derivative is %v, central difference %v", p.x, p.y, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDeriveErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   error
+	}{
+		{"x < 1", ErrNotDifferentiable},
+		{"x > 0 && x < 1", ErrNotDifferentiable},
+		{"!x", ErrNotDifferentiable},
+		{"true", ErrNotDifferentiable},
+		{"custom(x)", ErrNotDifferentiable},
+		{"pow(x)", ErrArgumentCount},
+		{"max()", ErrArgumentCount},
+	}
+	for _, tt := range tests {
+		expr, err := (&Context{}).ParseProgram(tt.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Derive(expr, "x"); !errors.Is(err, tt.want) {
+			t.Errorf("Derive(%q) error = %v, want %v", tt.source, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+// Environment maps variable names to values. Each block gets its own scope;
+// names not found in a scope are looked up in its parent.
+type Environment struct {
+	vars   map[string]Value
+	funcs  map[string]Function
+	parent *Environment
+	mode   NumericMode
+}
+
+// NewEnvironment creates a scope inside parent, which may be nil, using the
+// parent's numeric mode
+func NewEnvironment(parent *Environment) *Environment {
+	env := &Environment{vars: make(map[string]Value), parent: parent}
+	if parent != nil {
+		env.mode = parent.mode
+	}
+	return env
+}
+
+// Mode is the numeric mode expressions are interpreted in; MixedMode by default
+func (e *Environment) Mode() NumericMode {
+	if e == nil {
+		return MixedMode
+	}
+	return e.mode
+}
+
+func (e *Environment) SetMode(mode NumericMode) {
+	e.mode = mode
+}
+
+// Get returns the value of name from the innermost scope that defines it
+func (e *Environment) Get(name string) (Value, bool) {
+	for ; e != nil; e = e.parent {
+		if value, ok := e.vars[name]; ok {
+			return value, true
+		}
+	}
+	return Value{}, false
+}
+
+// Define binds name in this scope, shadowing any outer definition
+func (e *Environment) Define(name string, value Value) {
+	e.vars[name] = value
+}
+
+// TerminalExpression
+type Variable struct {
+	name string
+	pos  int
+}
+
+func (v *Variable) Interpret(env *Environment) (Value, error) {
+	return load(env, v.name, v.pos)
+}
+
+// load reads a variable for an expression at pos
+func load(env *Environment, name string, pos int) (Value, error) {
+	value, ok := env.Get(name)
+	if !ok {
+		return Value{}, &EvalError{Pos: pos, Token: name, Err: ErrUndefinedVariable}
+	}
+	value, err := env.Mode().convert(value)
+	if err != nil {
+		return Value{}, &EvalError{Pos: pos, Token: name, Err: err}
+	}
+	return value, nil
+}
+
+// Let binds the value of an expression to a name and evaluates to that value
+type Let struct {
+	name  string
+	value Expression
+}
+
+func (l *Let) Interpret(env *Environment) (Value, error) {
+	value, err := l.value.Interpret(env)
+	if err != nil {
+		return Value{}, err
+	}
+	env.Define(l.name, value)
+	return value, nil
+}
+
+// Program is a sequence of statements evaluated in order. Its value is the
+// value of the last statement.
+type Program struct {
+	statements []Expression
+}
+
+func (p *Program) Interpret(env *Environment) (Value, error) {
+	var result Value
+	for _, statement := range p.statements {
+		var err error
+		if result, err = statement.Interpret(env); err != nil {
+			return Value{}, err
+		}
+	}
+	return result, nil
+}
+
+// Block evaluates a program in a new scope, so its definitions do not leak out
+type Block struct {
+	body *Program
+}
+
+func (b *Block) Interpret(env *Environment) (Value, error) {
+	return b.body.Interpret(NewEnvironment(env))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrDivisionByZero    = errors.New("division by zero")
+	ErrUnknownOperator   = errors.New("unknown operator")
+	ErrUndefinedVariable = errors.New("undefined variable")
+	ErrNotInteger        = errors.New("not an integer")
+	ErrInexact           = errors.New("no exact value")
+	ErrNotNumber         = errors.New("not a number")
+	ErrNotBoolean        = errors.New("not a boolean")
+	ErrUndefinedFunction = errors.New("undefined function")
+	ErrArgumentCount     = errors.New("wrong number of arguments")
+	ErrNotCompilable     = errors.New("expression cannot be compiled")
+	ErrOverflow          = errors.New("result too large")
+	ErrNotDifferentiable = errors.New("not differentiable")
+)
+
+// SyntaxError reports input that cannot be parsed. Pos is the byte offset of
+// the offending token in infix source, or its index when parsing RPN tokens.
+type SyntaxError struct {
+	Pos   int
+	Token string
+	Msg   string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("syntax error at %d: %s", e.Pos, e.Msg)
+	}
+	return fmt.Sprintf("syntax error at %d near %q: %s", e.Pos, e.Token, e.Msg)
+}
+
+// EvalError reports an operation that failed during interpretation. Pos is
+// the position of the operator or variable, as in SyntaxError.
+type EvalError struct {
+	Pos   int
+	Token string
+	Err   error
+}
+
+func (e *EvalError) Error() string {
+	return fmt.Sprintf("evaluation error at %d near %q: %v", e.Pos, e.Token, e.Err)
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
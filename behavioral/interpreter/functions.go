@@ -0,0 +1,164 @@
+package main
+
+import (
+	"math"
+	"math/big"
+)
+
+// Function is a Go function that expressions can call by name
+type Function func(args ...Value) (Value, error)
+
+// Functions every environment knows; DefineFunc can shadow them
+var builtins = map[string]Function{
+	"min":  extreme(-1),
+	"max":  extreme(+1),
+	"abs":  abs,
+	"pow":  pow,
+	"sqrt": float(math.Sqrt),
+	"exp":  float(math.Exp),
+	"ln":   float(math.Log),
+	"sin":  float(math.Sin),
+	"cos":  float(math.Cos),
+	"tan":  float(math.Tan),
+}
+
+// DefineFunc makes fn callable by name in this scope and the scopes inside it
+func (e *Environment) DefineFunc(name string, fn Function) {
+	if e.funcs == nil {
+		e.funcs = make(map[string]Function)
+	}
+	e.funcs[name] = fn
+}
+
+// Func returns the function called name from the innermost scope that
+// defines it, falling back to the built-in functions
+func (e *Environment) Func(name string) (Function, bool) {
+	for ; e != nil; e = e.parent {
+		if fn, ok := e.funcs[name]; ok {
+			return fn, true
+		}
+	}
+	fn, ok := builtins[name]
+	return fn, ok
+}
+
+// NonTerminalExpression: name(args...)
+type Call struct {
+	name string
+	args []Expression
+	pos  int
+}
+
+func (c *Call) Interpret(env *Environment) (Value, error) {
+	fn, ok := env.Func(c.name)
+	if !ok {
+		return Value{}, &EvalError{Pos: c.pos, Token: c.name, Err: ErrUndefinedFunction}
+	}
+	args := make([]Value, len(c.args))
+	for i, arg := range c.args {
+		var err error
+		if args[i], err = arg.Interpret(env); err != nil {
+			return Value{}, err
+		}
+	}
+	return call(env, fn, args, c.name, c.pos)
+}
+
+// call runs a function for the call expression at pos
+func call(env *Environment, fn Function, args []Value, name string, pos int) (Value, error) {
+	result, err := fn(args...)
+	if err == nil {
+		// Go functions may return any kind, so bring the result into the mode
+		result, err = env.Mode().convert(result)
+	}
+	if err != nil {
+		return Value{}, &EvalError{Pos: pos, Token: name, Err: err}
+	}
+	return result, nil
+}
+
+// extreme returns min for sign -1 and max for sign +1
+func extreme(sign int) Function {
+	return func(args ...Value) (Value, error) {
+		if len(args) == 0 {
+			return Value{}, ErrArgumentCount
+		}
+		best := args[0]
+		for _, arg := range args {
+			c, err := compare(arg, best)
+			if err != nil {
+				return Value{}, err
+			}
+			if c == sign {
+				best = arg
+			}
+		}
+		return best, nil
+	}
+}
+
+func abs(args ...Value) (Value, error) {
+	if len(args) != 1 {
+		return Value{}, ErrArgumentCount
+	}
+	switch v := args[0]; v.kind {
+	case Integer:
+		i := v.BigInt()
+		return Value{kind: Integer, i: i.Abs(i)}, nil
+	case Rational:
+		r := v.Rat()
+		return ratValue(r.Abs(r)), nil
+	case Float:
+		return Float64(math.Abs(v.f)), nil
+	}
+	return Value{}, ErrNotNumber
+}
+
+// float wraps a float64 function of one argument, such as math.Sqrt
+func float(f func(float64) float64) Function {
+	return func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return Value{}, ErrArgumentCount
+		}
+		if args[0].kind == Boolean {
+			return Value{}, ErrNotNumber
+		}
+		return Float64(f(args[0].Float64())), nil
+	}
+}
+
+// Exact powers are refused when their result would need more bits than this
+const maxPowBits = 1 << 20
+
+// pow is exact for an integer or rational base raised to an integer power
+func pow(args ...Value) (Value, error) {
+	if len(args) != 2 {
+		return Value{}, ErrArgumentCount
+	}
+	base, exponent := args[0], args[1]
+	if base.kind == Boolean || exponent.kind == Boolean {
+		return Value{}, ErrNotNumber
+	}
+	if base.kind == Float || exponent.kind != Integer || !exponent.BigInt().IsInt64() {
+		// 0 to a negative power divides by zero, as it does for exact values
+		if base.Float64() == 0 && exponent.Float64() < 0 {
+			return Value{}, ErrDivisionByZero
+		}
+		return Float64(math.Pow(base.Float64(), exponent.Float64())), nil
+	}
+	r, n := base.Rat(), exponent.BigInt().Int64()
+	if n < 0 {
+		if r.Sign() == 0 {
+			return Value{}, ErrDivisionByZero
+		}
+		r.Inv(r)
+		n = -n
+	}
+	if bits := int64(max(r.Num().BitLen(), r.Denom().BitLen())); bits > 1 && n > maxPowBits/bits {
+		return Value{}, ErrOverflow
+	}
+	e := big.NewInt(n)
+	num := new(big.Int).Exp(r.Num(), e, nil)
+	denom := new(big.Int).Exp(r.Denom(), e, nil)
+	return ratValue(new(big.Rat).SetFrac(num, denom)), nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	numberToken tokenKind = iota
+	identToken
+	operatorToken
+	assignToken
+	leftParenToken
+	rightParenToken
+	leftBraceToken
+	rightBraceToken
+	commaToken
+	separatorToken // ";", or a newline not directly inside parentheses
+	endToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // byte offset in the input
+}
+
+var punctuation = map[rune]tokenKind{
+	'+': operatorToken,
+	'-': operatorToken,
+	'*': operatorToken,
+	'/': operatorToken,
+	'<': operatorToken,
+	'>': operatorToken,
+	'!': operatorToken,
+	'=': assignToken,
+	'(': leftParenToken,
+	')': rightParenToken,
+	'{': leftBraceToken,
+	'}': rightBraceToken,
+	',': commaToken,
+	';': separatorToken,
+}
+
+// Operators spelled with two characters, matched before single characters
+var twoCharOperators = []string{"==", "!=", "<=", ">=", "&&", "||"}
+
+// tokenize splits infix source into tokens, ending with an endToken
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	var open []tokenKind // unclosed parentheses and braces, innermost last
+	for i := 0; i < len(input); {
+		r, size := utf8.DecodeRuneInString(input[i:])
+		switch {
+		case r == '\n' && (len(open) == 0 || open[len(open)-1] != leftParenToken):
+			tokens = append(tokens, token{kind: separatorToken, text: "\n", pos: i})
+			i += size
+		case unicode.IsSpace(r):
+			i += size
+		case '0' <= r && r <= '9':
+			start := i
+			i = scanNumber(input, i)
+			tokens = append(tokens, token{kind: numberToken, text: input[start:i], pos: start})
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(input) {
+				r, size := utf8.DecodeRuneInString(input[i:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{kind: identToken, text: input[start:i], pos: start})
+		case isTwoCharOperator(input[i:]):
+			tokens = append(tokens, token{kind: operatorToken, text: input[i : i+2], pos: i})
+			i += 2
+		default:
+			kind, ok := punctuation[r]
+			if !ok {
+				return nil, &SyntaxError{Pos: i, Token: string(r), Msg: "unexpected character"}
+			}
+			switch kind {
+			case leftParenToken, leftBraceToken:
+				open = append(open, kind)
+			case rightParenToken, rightBraceToken:
+				if len(open) > 0 {
+					open = open[:len(open)-1]
+				}
+			}
+			tokens = append(tokens, token{kind: kind, text: string(r), pos: i})
+			i += size
+		}
+	}
+	return append(tokens, token{kind: endToken, pos: len(input)}), nil
+}
+
+// scanNumber returns the end of the number starting at i: digits, then an
+// optional fraction and exponent as in 12.5e-3
+func scanNumber(input string, i int) int {
+	digits := func(i int) int {
+		for i < len(input) && isDigit(input[i]) {
+			i++
+		}
+		return i
+	}
+	i = digits(i)
+	if i+1 < len(input) && input[i] == '.' && isDigit(input[i+1]) {
+		i = digits(i + 1)
+	}
+	if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+		j := i + 1
+		if j < len(input) && (input[j] == '+' || input[j] == '-') {
+			j++
+		}
+		if j < len(input) && isDigit(input[j]) {
+			i = digits(j)
+		}
+	}
+	return i
+}
+
+func isTwoCharOperator(s string) bool {
+	for _, op := range twoCharOperators {
+		if len(s) >= 2 && s[:2] == op {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
+}
+
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -2,42 +2,66 @@ package main
 
 import (
 	"fmt"
-	"strconv"
+	"math/big"
 	"strings"
 )
 
 // Expression interface
 type Expression interface {
-	Interpret() int
+	Interpret(env *Environment) (Value, error)
 }
 
-// TerminalExpression
+// TerminalExpression: a number, or the constant true or false
 type Number struct {
-	value int
+	value Value
+	text  string // source of a decimal literal, read exactly in ExactMode
+	pos   int
 }
 
-func (n *Number) Interpret() int {
-	return n.value
+func (n *Number) Interpret(env *Environment) (Value, error) {
+	return n.valueIn(env.Mode())
+}
+
+func (n *Number) valueIn(mode NumericMode) (Value, error) {
+	if n.text != "" && mode == ExactMode {
+		r, _ := new(big.Rat).SetString(n.text)
+		return ratValue(r), nil
+	}
+	value, err := mode.convert(n.value)
+	if err != nil {
+		return Value{}, &EvalError{Pos: n.pos, Token: n.String(), Err: err}
+	}
+	return value, nil
+}
+
+func (n *Number) String() string {
+	if n.text != "" {
+		return n.text
+	}
+	return n.value.String()
 }
 
 // NonTerminalExpression
 type Operation struct {
 	left, right Expression
 	operator    string
+	pos         int // position of the operator in the source
 }
 
-func (o *Operation) Interpret() int {
-	switch o.operator {
-	case "+":
-		return o.left.Interpret() + o.right.Interpret()
-	case "-":
-		return o.left.Interpret() - o.right.Interpret()
-	case "*":
-		return o.left.Interpret() * o.right.Interpret()
-	case "/":
-		return o.left.Interpret() / o.right.Interpret()
-	}
-	return 0
+func (o *Operation) Interpret(env *Environment) (Value, error) {
+	left, err := o.left.Interpret(env)
+	if err != nil {
+		return Value{}, err
+	}
+	right, err := o.right.Interpret(env)
+	if err != nil {
+		return Value{}, err
+	}
+	result, err := binary(o.operator, left, right, env.Mode())
+	if err != nil {
+		return Value{}, &EvalError{Pos: o.pos, Token: o.operator, Err: err}
+	}
+	return result, nil
 }
 
 // Context
@@ -45,9 +69,15 @@ type Context struct {
 	stack []Expression
 }
 
-func (c *Context) Parse(tokens []string) Expression {
-	for _, token := range tokens {
+// Parse builds the syntax tree for an expression in Reverse Polish Notation.
+// Positions in errors are indexes into tokens.
+func (c *Context) Parse(tokens []string) (Expression, error) {
+	c.stack = c.stack[:0]
+	for i, token := range tokens {
 		if token == "+" || token == "-" || token == "*" || token == "/" {
+			if len(c.stack) < 2 {
+				return nil, &SyntaxError{Pos: i, Token: token, Msg: "operator needs two operands"}
+			}
 			right := c.stack[len(c.stack)-1]
 			c.stack = c.stack[:len(c.stack)-1]
 			left := c.stack[len(c.stack)-1]
@@ -57,18 +87,215 @@ func (c *Context) Parse(tokens []string) Expression {
 				left:     left,
 				right:    right,
 				operator: token,
+				pos:      i,
 			})
+		} else if isIdentifier(token) {
+			c.stack = append(c.stack, &Variable{name: token, pos: i})
 		} else {
-			num, _ := strconv.Atoi(token)
-			c.stack = append(c.stack, &Number{value: num})
+			num, err := parseNumber(token, i)
+			if err != nil {
+				return nil, err
+			}
+			c.stack = append(c.stack, num)
 		}
 	}
-	return c.stack[len(c.stack)-1]
+	switch len(c.stack) {
+	case 0:
+		return nil, &SyntaxError{Pos: len(tokens), Msg: "empty expression"}
+	case 1:
+		return c.stack[0], nil
+	}
+	return nil, &SyntaxError{Pos: len(tokens), Msg: fmt.Sprintf("%d operands left on the stack", len(c.stack))}
 }
 
 func main() {
 	context := &Context{}
-	expression := context.Parse(strings.Fields("3 4 + 2 * 7 /"))
+	env := NewEnvironment(nil)
+	expression, err := context.Parse(strings.Fields("3 4 + 2 * 7 /"))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	result, err := expression.Interpret(env)
+	fmt.Println("Result:", result, err)
+
+	// The same expression in infix notation
+	expression, err = context.ParseInfix("(3 + 4) * 2 / 7")
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	result, err = expression.Interpret(env)
+	fmt.Println("Result:", result, err)
+
+	expression, err = context.ParseInfix("-2 * (10 - 4 - 3) + 20 / 2 / 5")
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	result, err = expression.Interpret(env)
+	fmt.Println("Result:", result, err) // -2 * 3 + 2 = -4
+
+	// Mistakes are reported with their position instead of panicking
+	for _, source := range []string{"3 + * 4", "(1 + 2", "8 / (4 - 2 * 2)"} {
+		expression, err := context.ParseInfix(source)
+		if err == nil {
+			_, err = expression.Interpret(env)
+		}
+		fmt.Printf("%s: %v\n", source, err)
+	}
+	for _, source := range []string{"3 +", "3 $ +", "1 2 3 +"} {
+		_, err := context.Parse(strings.Fields(source))
+		fmt.Printf("%s: %v\n", source, err)
+	}
+
+	// Programs define variables with let; a block opens a nested scope
+	program, err := context.ParseProgram(`
+let base = 100
+let tax = base * 20 / 100
+let total = {
+	let discount = 15
+	base + tax - discount
+}
+total`)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	result, err = program.Interpret(env)
+	fmt.Println("Result:", result, err) // 100 + 20 - 15 = 105
 
-	fmt.Println("Result:", expression.Interpret())
+	// Variables defined by one program are visible to later expressions
+	expression, err = context.Parse(strings.Fields("total tax -"))
+	if err == nil {
+		result, err = expression.Interpret(env)
+	}
+	fmt.Println("Result:", result, err)
+
+	for _, source := range []string{"discount * 2", "let = 3", "let x = 1; x +"} {
+		program, err := context.ParseProgram(source)
+		if err == nil {
+			_, err = program.Interpret(env)
+		}
+		fmt.Printf("%s: %v\n", source, err)
+	}
+
+	// The numeric mode decides how numbers are represented
+	for _, mode := range []struct {
+		name string
+		mode NumericMode
+	}{{"mixed", MixedMode}, {"exact", ExactMode}, {"float", FloatMode}, {"integer", IntegerMode}} {
+		env := NewEnvironment(nil)
+		env.SetMode(mode.mode)
+		for _, source := range []string{"7 / 2", "0.1 + 0.2", "9223372036854775807 * 4"} {
+			expression, err := context.ParseInfix(source)
+			if err == nil {
+				result, err = expression.Interpret(env)
+			}
+			if err != nil {
+				fmt.Printf("%s: %s: %v\n", mode.name, source, err)
+				continue
+			}
+			fmt.Printf("%s: %s = %v\n", mode.name, source, result)
+		}
+	}
+
+	// Exact arithmetic for money: three items at 19.99 with 7.5% tax
+	env.SetMode(ExactMode)
+	program, err = context.ParseProgram("let subtotal = 3 * 19.99; subtotal + subtotal * 0.075")
+	if err == nil {
+		result, err = program.Interpret(env)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Println("Total:", result, "=", result.Rat().FloatString(4))
+
+	// A feature flag rule with a function registered from Go
+	rules := NewEnvironment(nil)
+	rules.DefineFunc("bucket", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return Value{}, ErrArgumentCount
+		}
+		// Spread user ids over 100 buckets for percentage rollouts
+		return Int(new(big.Int).Mod(args[0].BigInt(), big.NewInt(100)).Int64()), nil
+	})
+	rule, err := context.ParseProgram(`
+let beta = country == 1 && (plan >= 2 || bucket(user) < 10)
+if(beta, max(limit, 100), min(limit, pow(2, 5)))`)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	for _, user := range []int64{1205, 1250} {
+		scope := NewEnvironment(rules)
+		scope.Define("user", Int(user))
+		scope.Define("country", Int(1))
+		scope.Define("plan", Int(1))
+		scope.Define("limit", Int(50))
+		result, err := rule.Interpret(scope)
+		fmt.Printf("user %d: limit %v %v\n", user, result, err)
+	}
+
+	// The same rule compiled to bytecode for a stack machine
+	code, err := Compile(rule)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Print(code)
+	scope := NewEnvironment(rules)
+	scope.Define("user", Int(1205))
+	scope.Define("country", Int(1))
+	scope.Define("plan", Int(1))
+	scope.Define("limit", Int(50))
+	result, err = code.Interpret(scope)
+	fmt.Println("Result:", result, err)
+
+	// Optimizing folds constants and removes identities before compiling
+	formula, err := context.ParseInfix("price * (1 + 20 / 100) * 1 + (quantity - quantity * 0) * (2 + 3)")
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	before, _ := Compile(formula)
+	after, err := Compile(Optimize(formula, ExactMode))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Print(after)
+	prices := NewEnvironment(nil)
+	prices.SetMode(ExactMode)
+	prices.Define("price", Rat(1999, 100))
+	prices.Define("quantity", Int(3))
+	want, _ := formula.Interpret(prices)
+	result, err = after.Interpret(prices)
+	fmt.Printf("%d instructions before, %d after: %v = %v %v\n", len(before.code), len(after.code), want, result, err)
+
+	// Derivatives of a pricing formula show how sensitive it is to each input
+	pricing, err := context.ParseProgram(`
+let net = price * quantity * (1 - discount)
+net + net * rate + shipping * sqrt(quantity)`)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	inputs := NewEnvironment(nil)
+	inputs.SetMode(FloatMode)
+	inputs.Define("price", Rat(1999, 100))
+	inputs.Define("quantity", Int(4))
+	inputs.Define("discount", Rat(1, 10))
+	inputs.Define("rate", Rat(1, 5))
+	inputs.Define("shipping", Int(3))
+	for _, name := range []string{"price", "quantity", "discount"} {
+		derivative, err := Derive(pricing, name)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		result, err := derivative.Interpret(inputs)
+		fmt.Printf("d/d%s = %v = %v %v\n", name, derivative, result, err)
+	}
 }
@@ -0,0 +1,174 @@
+package main
+
+// Optimize returns a simplified copy of expr for interpreting in the given
+// numeric mode. Constant subtrees are folded into numbers, identities such as
+// x*1 and x+0 are removed, and constants are moved to the right of
+// commutative operators so that they can meet and fold.
+//
+// Whenever expr evaluates without error, the optimized expression evaluates
+// to the same value. Constants that would fold to an infinite or NaN float are
+// left unfolded, so the result always prints as source that parses back. Subexpressions that would fail are never folded, but an
+// identity may drop an operand whose evaluation would have failed.
+func Optimize(expr Expression, mode NumericMode) Expression {
+	return optimizer{mode: mode}.optimize(expr)
+}
+
+type optimizer struct {
+	mode NumericMode
+}
+
+func (o optimizer) optimize(expr Expression) Expression {
+	switch e := expr.(type) {
+	case *Operation:
+		return o.operation(e.operator, o.optimize(e.left), o.optimize(e.right), e.pos)
+	case *Not:
+		operand := o.optimize(e.operand)
+		if inner, ok := operand.(*Not); ok {
+			return inner.operand
+		}
+		return o.fold(&Not{operand: operand, pos: e.pos}, e.pos, operand)
+	case *Logical:
+		left, right := o.optimize(e.left), o.optimize(e.right)
+		folded := o.fold(&Logical{left: left, right: right, operator: e.operator, pos: e.pos}, e.pos, left, right)
+		if v, ok := o.constant(left); ok && v.kind == Boolean {
+			if _, ok := folded.(*Number); ok {
+				return folded
+			}
+			if v.b == (e.operator == "||") {
+				return left // the right operand is never evaluated
+			}
+			return right
+		}
+		return folded
+	case *If:
+		cond := o.optimize(e.cond)
+		if v, ok := o.constant(cond); ok && v.kind == Boolean {
+			if v.b {
+				return o.optimize(e.then)
+			}
+			return o.optimize(e.otherwise)
+		}
+		return &If{cond: cond, then: o.optimize(e.then), otherwise: o.optimize(e.otherwise), pos: e.pos}
+	case *Call:
+		// Calls are not folded: DefineFunc may replace even the built-in functions
+		args := make([]Expression, len(e.args))
+		for i, arg := range e.args {
+			args[i] = o.optimize(arg)
+		}
+		return &Call{name: e.name, args: args, pos: e.pos}
+	case *Let:
+		return &Let{name: e.name, value: o.optimize(e.value)}
+	case *Program:
+		return o.program(e)
+	case *Block:
+		return &Block{body: o.program(e.body)}
+	}
+	// Numbers and variables cannot be simplified, and other expressions are unknown
+	return expr
+}
+
+func (o optimizer) program(p *Program) *Program {
+	out := &Program{}
+	for i, statement := range p.statements {
+		statement = o.optimize(statement)
+		// A constant is only worth keeping as the value of the program
+		if _, ok := o.constant(statement); ok && i < len(p.statements)-1 {
+			continue
+		}
+		out.statements = append(out.statements, statement)
+	}
+	return out
+}
+
+// Operators whose operands can be swapped, and how comparisons are flipped
+var (
+	commutative = map[string]bool{"+": true, "*": true, "==": true, "!=": true}
+	flipped     = map[string]string{"<": ">", "<=": ">=", ">": "<", ">=": "<="}
+)
+
+func (o optimizer) operation(operator string, left, right Expression, pos int) Expression {
+	node := &Operation{left: left, right: right, operator: operator, pos: pos}
+	folded := o.fold(node, pos, left, right)
+	if folded != node {
+		return folded
+	}
+	_, leftConstant := o.constant(left)
+	if _, rightConstant := o.constant(right); leftConstant && !rightConstant {
+		if commutative[operator] {
+			return o.operation(operator, right, left, pos)
+		}
+		if flip, ok := flipped[operator]; ok {
+			return o.operation(flip, right, left, pos)
+		}
+	}
+	if c, ok := o.constant(right); ok && o.neutral(c) {
+		switch {
+		case (operator == "+" || operator == "-") && c.Float64() == 0,
+			(operator == "*" || operator == "/") && c.Float64() == 1:
+			return left
+		case operator == "*" && c.Float64() == 0 && o.exact():
+			return &Number{value: Int(0), pos: pos}
+		}
+	}
+	if (operator == "+" || operator == "*") && o.exact() {
+		// (a + c) + d folds to a + (c + d), and (a + c) + b becomes (a + b) + c
+		// so that constants gather on the right
+		if inner, ok := left.(*Operation); ok && inner.operator == operator {
+			if o.numeric(inner.right) {
+				if o.numeric(right) {
+					return o.operation(operator, inner.left, o.operation(operator, inner.right, right, pos), inner.pos)
+				}
+				return o.operation(operator, o.operation(operator, inner.left, right, inner.pos), inner.right, pos)
+			}
+		}
+	}
+	return node
+}
+
+// exact reports whether the mode rules out floats, so that arithmetic is
+// associative and anything times zero is zero
+func (o optimizer) exact() bool {
+	return o.mode == ExactMode || o.mode == IntegerMode
+}
+
+// neutral reports whether combining a value with c can leave the value's kind
+// unchanged, so that c can act as an identity element
+func (o optimizer) neutral(c Value) bool {
+	return c.kind == Integer || (c.kind == Float && o.mode == FloatMode)
+}
+
+// numeric reports whether expr is a numeric constant; adding or multiplying
+// two of them always folds
+func (o optimizer) numeric(expr Expression) bool {
+	v, ok := o.constant(expr)
+	return ok && v.kind != Boolean
+}
+
+// constant returns the value of a number literal in the mode
+func (o optimizer) constant(expr Expression) (Value, bool) {
+	n, ok := expr.(*Number)
+	if !ok {
+		return Value{}, false
+	}
+	v, err := n.valueIn(o.mode)
+	return v, err == nil
+}
+
+// fold evaluates expr if all its operands are constants. Expressions that
+// fail are kept, so that the error is reported when they are interpreted, and
+// so are those that overflow to an infinite or NaN float, which could not be
+// printed back as a literal.
+func (o optimizer) fold(expr Expression, pos int, operands ...Expression) Expression {
+	for _, operand := range operands {
+		if _, ok := o.constant(operand); !ok {
+			return expr
+		}
+	}
+	env := NewEnvironment(nil)
+	env.SetMode(o.mode)
+	v, err := expr.Interpret(env)
+	if err != nil || !v.finite() {
+		return expr
+	}
+	return &Number{value: v, pos: pos}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// checkOptimized interprets a random program before and after optimizing it,
+// in every numeric mode. Whenever the original program succeeds, the
+// optimized one must give the same value.
+func checkOptimized(t *testing.T, seed int64) {
+	program := randomProgram(rand.New(rand.NewSource(seed)))
+	for mode := MixedMode; mode <= IntegerMode; mode++ {
+		optimized := Optimize(program, mode)
+		want, wantErr := program.Interpret(checkEnvironment(mode))
+		got, gotErr := optimized.Interpret(checkEnvironment(mode))
+		if wantErr == nil && (gotErr != nil || !sameValue(want, got)) {
+			before, _ := Compile(program)
+			after, _ := Compile(optimized)
+			t.Fatalf("seed %d in mode %d: original gives %v, optimized gives %v (%v)\n%s\noptimized to\n%s",
+				seed, mode, want, got, gotErr, before, after)
+		}
+	}
+}
+
+// sameValue reports whether two values have the same kind and compare equal
+func sameValue(a, b Value) bool {
+	if a.kind != b.kind {
+		return false
+	}
+	if a.kind == Boolean {
+		return a.b == b.b
+	}
+	c, err := compare(a, b)
+	return err == nil && c == 0
+}
+
+func TestOptimizerPreservesValues(t *testing.T) {
+	n := int64(20000)
+	if testing.Short() {
+		n = 1000
+	}
+	for seed := int64(0); seed < n; seed++ {
+		checkOptimized(t, seed)
+	}
+}
+
+func FuzzOptimize(f *testing.F) {
+	f.Add(int64(0))
+	f.Fuzz(checkOptimized)
+}
+
+func TestOptimizeExamples(t *testing.T) {
+	tests := []struct {
+		source string
+		mode   NumericMode
+		want   string
+	}{
+		{"x * 1 + 0", MixedMode, "x"},
+		{"20 / 100 * price", ExactMode, "price * (1/5)"},
+		{"(x + 2) + 3", ExactMode, "x + 5"},
+		{"(x + 2) + 3", FloatMode, "x + 2 + 3"},
+		{"3 < x", MixedMode, "x > 3"},
+		{"if(1 < 2, a, b)", MixedMode, "a"},
+		{"false && x", MixedMode, "false"},
+		{"!!ok", MixedMode, "ok"},
+		{"x * 0", ExactMode, "0"},
+		{"x * 0", MixedMode, "x * 0"},
+		{"1 / 0 + x", MixedMode, "1 / 0 + x"},
+		{"max(1, 2)", MixedMode, "max(1, 2)"},
+	}
+	for _, tt := range tests {
+		expr, err := (&Context{}).ParseProgram(tt.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := stringOf(Optimize(expr, tt.mode)); got != tt.want {
+			t.Errorf("Optimize(%q, mode %d) = %q, want %q", tt.source, tt.mode, got, tt.want)
+		}
+	}
+}
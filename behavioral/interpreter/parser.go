@@ -0,0 +1,246 @@
+package main
+
+// Binary operators by precedence; a higher precedence binds tighter. All of
+// them are left-associative.
+var binaryOperators = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3,
+	"!=": 3,
+	"<":  4,
+	"<=": 4,
+	">":  4,
+	">=": 4,
+	"+":  5,
+	"-":  5,
+	"*":  6,
+	"/":  6,
+}
+
+// Names that cannot be used as variables
+var keywords = map[string]bool{"let": true, "if": true, "true": true, "false": true}
+
+// ParseInfix builds the syntax tree for an expression in ordinary infix
+// notation such as "(3 + 4) * 2 / 7"
+func (c *Context) ParseInfix(input string) (Expression, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.parseExpression(1)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != endToken {
+		return nil, &SyntaxError{Pos: t.pos, Token: t.text, Msg: "unexpected token after expression"}
+	}
+	return expr, nil
+}
+
+// ParseProgram builds a program from statements separated by newlines or
+// semicolons. A statement is an expression or "let name = expression":
+//
+//	let base = 100
+//	let tax = base * 20 / 100
+//	base + tax
+func (c *Context) ParseProgram(input string) (*Program, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	program, err := p.parseStatements(endToken)
+	if err != nil {
+		return nil, err
+	}
+	if len(program.statements) == 0 {
+		return nil, &SyntaxError{Pos: len(input), Msg: "empty program"}
+	}
+	return program, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != endToken {
+		p.pos++
+	}
+	return t
+}
+
+// parseStatements parses statements up to, but not including, a token of kind end
+func (p *parser) parseStatements(end tokenKind) (*Program, error) {
+	program := &Program{}
+	for {
+		for p.peek().kind == separatorToken {
+			p.next()
+		}
+		if t := p.peek(); t.kind == end || t.kind == endToken {
+			return program, nil
+		}
+		statement, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		program.statements = append(program.statements, statement)
+		if t := p.peek(); t.kind != separatorToken && t.kind != end && t.kind != endToken {
+			return nil, &SyntaxError{Pos: t.pos, Token: t.text, Msg: "expected end of statement"}
+		}
+	}
+}
+
+func (p *parser) parseStatement() (Expression, error) {
+	if t := p.peek(); t.kind != identToken || t.text != "let" {
+		return p.parseExpression(1)
+	}
+	p.next()
+	name := p.next()
+	if name.kind != identToken || keywords[name.text] {
+		return nil, &SyntaxError{Pos: name.pos, Token: name.text, Msg: "expected a variable name"}
+	}
+	if t := p.next(); t.kind != assignToken {
+		return nil, &SyntaxError{Pos: t.pos, Token: t.text, Msg: `expected "="`}
+	}
+	value, err := p.parseExpression(1)
+	if err != nil {
+		return nil, err
+	}
+	return &Let{name: name.text, value: value}, nil
+}
+
+// parseExpression parses operands joined by binary operators of at least
+// minPrecedence, using precedence climbing
+func (p *parser) parseExpression(minPrecedence int) (Expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		precedence, ok := binaryOperators[t.text]
+		if t.kind != operatorToken || !ok || precedence < minPrecedence {
+			return left, nil
+		}
+		p.next()
+		// Operands on the right must bind tighter, so a - b - c is (a - b) - c
+		right, err := p.parseExpression(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+		if t.text == "&&" || t.text == "||" {
+			left = &Logical{left: left, right: right, operator: t.text, pos: t.pos}
+		} else {
+			left = &Operation{left: left, right: right, operator: t.text, pos: t.pos}
+		}
+	}
+}
+
+// parseUnary handles prefix signs and !, which bind tighter than any binary operator
+func (p *parser) parseUnary() (Expression, error) {
+	t := p.peek()
+	if t.kind == operatorToken && t.text == "!" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{operand: operand, pos: t.pos}, nil
+	}
+	if t.kind == operatorToken && (t.text == "-" || t.text == "+") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil || t.text == "+" {
+			return operand, err
+		}
+		// -x is represented as 0 - x
+		return &Operation{left: &Number{value: Int(0), pos: t.pos}, right: operand, operator: "-", pos: t.pos}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expression, error) {
+	t := p.next()
+	switch t.kind {
+	case numberToken:
+		return parseNumber(t.text, t.pos)
+	case identToken:
+		switch {
+		case t.text == "true" || t.text == "false":
+			return &Number{value: Bool(t.text == "true"), pos: t.pos}, nil
+		case p.peek().kind == leftParenToken:
+			return p.parseCall(t)
+		case t.text == "let":
+			return nil, &SyntaxError{Pos: t.pos, Token: t.text, Msg: "let is only allowed at the start of a statement"}
+		case keywords[t.text]:
+			return nil, &SyntaxError{Pos: t.pos, Token: t.text, Msg: `expected "(" after ` + t.text}
+		}
+		return &Variable{name: t.text, pos: t.pos}, nil
+	case leftBraceToken:
+		body, err := p.parseStatements(rightBraceToken)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != rightBraceToken {
+			return nil, &SyntaxError{Pos: closing.pos, Token: closing.text, Msg: `expected "}"`}
+		}
+		if len(body.statements) == 0 {
+			return nil, &SyntaxError{Pos: t.pos, Token: t.text, Msg: "empty block"}
+		}
+		return &Block{body: body}, nil
+	case leftParenToken:
+		expr, err := p.parseExpression(1)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != rightParenToken {
+			return nil, &SyntaxError{Pos: closing.pos, Token: closing.text, Msg: `expected ")"`}
+		}
+		return expr, nil
+	case endToken:
+		return nil, &SyntaxError{Pos: t.pos, Msg: "unexpected end of input"}
+	}
+	return nil, &SyntaxError{Pos: t.pos, Token: t.text, Msg: "expected a number, variable, \"(\" or \"{\""}
+}
+
+// parseCall parses the arguments of a call to name; if(cond, a, b) becomes an If
+func (p *parser) parseCall(name token) (Expression, error) {
+	p.next() // "("
+	var args []Expression
+	if p.peek().kind == rightParenToken {
+		p.next()
+	} else {
+		for {
+			arg, err := p.parseExpression(1)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			t := p.next()
+			if t.kind == rightParenToken {
+				break
+			}
+			if t.kind != commaToken {
+				return nil, &SyntaxError{Pos: t.pos, Token: t.text, Msg: `expected "," or ")"`}
+			}
+		}
+	}
+	switch name.text {
+	case "if":
+		if len(args) != 3 {
+			return nil, &SyntaxError{Pos: name.pos, Token: name.text, Msg: "if needs a condition and two branches"}
+		}
+		return &If{cond: args[0], then: args[1], otherwise: args[2], pos: name.pos}, nil
+	case "let", "true", "false":
+		return nil, &SyntaxError{Pos: name.pos, Token: name.text, Msg: "not a function"}
+	}
+	return &Call{name: name.text, args: args, pos: name.pos}, nil
+}
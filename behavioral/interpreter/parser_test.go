@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// run parses and interprets source in MixedMode with x defined as 7
+func run(source string) (Value, error) {
+	program, err := (&Context{}).ParseProgram(source)
+	if err != nil {
+		return Value{}, err
+	}
+	return program.Interpret(checkEnvironment(MixedMode))
+}
+
+func TestParseProgram(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		printed string // with only the parentheses precedence requires
+		want    string
+	}{
+		{"product before sum", "1 + 2 * 3", "1 + 2 * 3", "7"},
+		{"parentheses", "(1 + 2) * 3", "(1 + 2) * 3", "9"},
+		{"left-associative difference", "10 - 4 - 3", "10 - 4 - 3", "3"},
+		{"grouped difference", "10 - (4 - 3)", "10 - (4 - 3)", "9"},
+		{"left-associative quotient", "64 / 4 / 2", "64 / 4 / 2", "8"},
+		{"exact quotient", "7 / 2", "7 / 2", "7/2"},
+		{"unary minus binds tighter than *", "-2 * 3", "-2 * 3", "-6"},
+		{"unary minus on the right", "2 * -x", "2 * -x", "-14"},
+		{"double negation", "--x", "--x", "7"},
+		{"negated group", "-(2 + 3)", "-(2 + 3)", "-5"},
+		{"unary plus", "+x - +1", "x - 1", "6"},
+		{"comparison before equality", "1 < 2 == true", "1 < 2 == true", "true"},
+		{"sum before comparison", "x + 1 > 2 * 4", "x + 1 > 2 * 4", "false"},
+		{"&& before ||", "false && false || true", "false && false || true", "true"},
+		{"grouped ||", "false && (false || true)", "false && (false || true)", "false"},
+		{"! binds tighter than ||", "!true || true", "!true || true", "true"},
+		{"negated group of ||", "!(true || true)", "!(true || true)", "false"},
+		{"newlines separate statements", "let a = 2\nlet b = a * 3\nb", "let a = 2; let b = a * 3; b", "6"},
+		{"newline inside parentheses", "(1 +\n2)", "1 + 2", "3"},
+		{"redefinition", "let a = 1; let a = a + 1; a", "let a = 1; let a = a + 1; a", "2"},
+		{"block shadows", "let a = 1; { let a = 2; a } + a", "let a = 1; { let a = 2; a } + a", "3"},
+		{"block definitions stay inside", "let a = 1; { let a = a + 1 }; a", "let a = 1; { let a = a + 1 }; a", "1"},
+		{"block sees outer variables", "{ x * 2 }", "{ x * 2 }", "14"},
+		{"call", "max(1, x, 3)", "max(1, x, 3)", "7"},
+		{"nested calls", "pow(abs(-2), min(10, x + 3))", "pow(abs(-2), min(10, x + 3))", "1024"},
+		{"call in comparison", "min(2, 1) == 1", "min(2, 1) == 1", "true"},
+		{"if takes one branch", "if(x > 0, 10, 1 / 0)", "if(x > 0, 10, 1 / 0)", "10"},
+		{"if otherwise", "if(false, 1, 2)", "if(false, 1, 2)", "2"},
+		{"&& short-circuits", "false && 1 / 0 > 0", "false && 1 / 0 > 0", "false"},
+		{"|| short-circuits", "true || nope", "true || nope", "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, err := (&Context{}).ParseProgram(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := stringOf(program); got != tt.printed {
+				t.Errorf("parsed as %q, want %q", got, tt.printed)
+			}
+			v, err := program.Interpret(checkEnvironment(MixedMode))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(v); got != tt.want {
+				t.Errorf("%q = %s, want %s", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		pos    int
+		token  string
+	}{
+		{"", 0, ""},
+		{"1 +", 3, ""},
+		{"1 + * 2", 4, "*"},
+		{"(1 + 2", 6, ""},
+		{"1 2", 2, "2"},
+		{"1 $ 2", 2, "$"},
+		{"x + let", 4, "let"},
+		{"let 3 = 4", 4, "3"},
+		{"let if = 4", 4, "if"},
+		{"let a 4", 6, "4"},
+		{"if(x, 1)", 0, "if"},
+		{"if + 1", 0, "if"},
+		{"true(1)", 4, "("},
+		{"x + let(1)", 4, "let"},
+		{"max(1 2)", 6, "2"},
+		{"{ }", 0, "{"},
+		{"{ 1", 3, ""},
+		{"let a = 1\n  + )", 14, ")"},
+	}
+	for _, tt := range tests {
+		_, err := (&Context{}).ParseProgram(tt.source)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%q: err = %v, want a SyntaxError", tt.source, err)
+			continue
+		}
+		if syntaxErr.Pos != tt.pos || syntaxErr.Token != tt.token {
+			t.Errorf("%q: error at %d near %q, want %d near %q (%v)",
+				tt.source, syntaxErr.Pos, syntaxErr.Token, tt.pos, tt.token, err)
+		}
+	}
+
+	if _, err := (&Context{}).ParseInfix("1 + 2 )"); err == nil || err.(*SyntaxError).Pos != 6 {
+		t.Errorf("ParseInfix with a trailing token: err = %v, want a SyntaxError at 6", err)
+	}
+	if _, err := (&Context{}).Parse([]string{"3", "+", "4"}); err == nil || err.(*SyntaxError).Pos != 1 {
+		t.Errorf("RPN with a missing operand: err = %v, want a SyntaxError at token 1", err)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		pos    int
+		token  string
+		want   error
+	}{
+		{"1 + 2 / 0", 6, "/", ErrDivisionByZero},
+		{"x + nope", 4, "nope", ErrUndefinedVariable},
+		{"{ let a = 1 }; a", 15, "a", ErrUndefinedVariable},
+		{"let a = 1\nfoo(a)", 10, "foo", ErrUndefinedFunction},
+		{"1 + true", 2, "+", ErrNotNumber},
+		{"!1", 0, "!", ErrNotBoolean},
+		{"1 && true", 2, "&&", ErrNotBoolean},
+		{"if(1, 2, 3)", 0, "if", ErrNotBoolean},
+		{"pow(2)", 0, "pow", ErrArgumentCount},
+		{"true < false", 5, "<", ErrNotNumber},
+	}
+	for _, tt := range tests {
+		_, err := run(tt.source)
+		var evalErr *EvalError
+		if !errors.As(err, &evalErr) || !errors.Is(err, tt.want) {
+			t.Errorf("%q: err = %v, want an EvalError wrapping %v", tt.source, err, tt.want)
+			continue
+		}
+		if evalErr.Pos != tt.pos || evalErr.Token != tt.token {
+			t.Errorf("%q: error at %d near %q, want %d near %q", tt.source, evalErr.Pos, evalErr.Token, tt.pos, tt.token)
+		}
+	}
+}
+
+func TestDivisionByZeroInEveryMode(t *testing.T) {
+	sources := []string{"1 / 0", "x / (x - 7)", "pow(0, -1)", "pow(x - 7, -3)", "pow(0, 0 - 3 / 2)"}
+	for mode := MixedMode; mode <= IntegerMode; mode++ {
+		for _, source := range sources {
+			program, err := (&Context{}).ParseProgram(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := Compile(program)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, expr := range map[string]interface {
+				Interpret(*Environment) (Value, error)
+			}{"tree": program, "bytecode": code} {
+				v, err := expr.Interpret(checkEnvironment(mode))
+				if !errors.Is(err, ErrDivisionByZero) {
+					t.Errorf("%s in mode %d as a %s = %v, %v, want ErrDivisionByZero", source, mode, name, v, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+)
+
+// Precedence of expressions that are never split by an operator around them
+const (
+	unaryPrecedence  = 7
+	atomicPrecedence = 8
+)
+
+// format prints an expression in the infix syntax that ParseProgram reads,
+// returning the text and how tightly it binds. Operands that bind more
+// loosely than their operator are put in parentheses.
+func format(expr Expression) (string, int) {
+	switch e := expr.(type) {
+	case *Number:
+		s := e.String()
+		switch {
+		case e.text == "" && e.value.kind == Rational:
+			return s, binaryOperators["/"]
+		case strings.HasPrefix(s, "-"):
+			return s, unaryPrecedence
+		}
+		return s, atomicPrecedence
+	case *Variable:
+		return e.name, atomicPrecedence
+	case *Operation:
+		if zero, ok := e.left.(*Number); ok && e.operator == "-" && zero.text == "" &&
+			zero.value.kind == Integer && zero.value.BigInt().Sign() == 0 {
+			// The parser reads -x as 0 - x
+			return "-" + operand(e.right, unaryPrecedence), unaryPrecedence
+		}
+		return binaryString(e.left, e.right, e.operator)
+	case *Logical:
+		return binaryString(e.left, e.right, e.operator)
+	case *Not:
+		return "!" + operand(e.operand, unaryPrecedence), unaryPrecedence
+	case *Call:
+		return callString(e.name, e.args...), atomicPrecedence
+	case *If:
+		return callString("if", e.cond, e.then, e.otherwise), atomicPrecedence
+	case *Let:
+		s, _ := format(e.value)
+		return "let " + e.name + " = " + s, 0
+	case *Program:
+		return programString(e), 0
+	case *Block:
+		return "{ " + programString(e.body) + " }", atomicPrecedence
+	}
+	return "<unknown>", atomicPrecedence
+}
+
+func binaryString(left, right Expression, operator string) (string, int) {
+	p := binaryOperators[operator]
+	// Operators associate to the left, so a right operand of the same
+	// precedence needs parentheses
+	return operand(left, p) + " " + operator + " " + operand(right, p+1), p
+}
+
+// operand prints expr, in parentheses if it binds more loosely than min
+func operand(expr Expression, min int) string {
+	s, p := format(expr)
+	if p < min {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+func callString(name string, args ...Expression) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i], _ = format(arg)
+	}
+	return name + "(" + strings.Join(parts, ", ") + ")"
+}
+
+func programString(p *Program) string {
+	parts := make([]string, len(p.statements))
+	for i, statement := range p.statements {
+		parts[i], _ = format(statement)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (v *Variable) String() string  { return stringOf(v) }
+func (o *Operation) String() string { return stringOf(o) }
+func (l *Logical) String() string   { return stringOf(l) }
+func (n *Not) String() string       { return stringOf(n) }
+func (c *Call) String() string      { return stringOf(c) }
+func (i *If) String() string        { return stringOf(i) }
+func (l *Let) String() string       { return stringOf(l) }
+func (p *Program) String() string   { return stringOf(p) }
+func (b *Block) String() string     { return stringOf(b) }
+
+func stringOf(expr Expression) string {
+	s, _ := format(expr)
+	return s
+}
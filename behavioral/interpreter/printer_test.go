@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// checkPrinted prints an expression, parses the text back and fails unless
+// the result interprets the same in mode. Folded fractions such as 54/5 parse
+// back as divisions, so it is the second printing that must be stable.
+func checkPrinted(t *testing.T, expr Expression, mode NumericMode) {
+	t.Helper()
+	text := stringOf(expr)
+	parsed, err := (&Context{}).ParseProgram(text)
+	if err != nil {
+		t.Fatalf("%q does not parse: %v", text, err)
+	}
+	text = stringOf(parsed)
+	reparsed, err := (&Context{}).ParseProgram(text)
+	if err != nil {
+		t.Fatalf("%q does not parse: %v", text, err)
+	}
+	if again := stringOf(reparsed); again != text {
+		t.Fatalf("%q parses back as %q", text, again)
+	}
+	want, wantErr := expr.Interpret(checkEnvironment(mode))
+	got, gotErr := parsed.Interpret(checkEnvironment(mode))
+	if (wantErr == nil) != (gotErr == nil) || (wantErr == nil && !sameValue(want, got)) {
+		t.Fatalf("%q in mode %d: printed tree gives %v (%v), parsed text gives %v (%v)",
+			text, mode, want, wantErr, got, gotErr)
+	}
+}
+
+func TestPrinterRoundTrips(t *testing.T) {
+	n := int64(5000)
+	if testing.Short() {
+		n = 500
+	}
+	for seed := int64(0); seed < n; seed++ {
+		program := randomProgram(rand.New(rand.NewSource(seed)))
+		for mode := MixedMode; mode <= IntegerMode; mode++ {
+			checkPrinted(t, program, mode)
+			checkPrinted(t, Optimize(program, mode), mode)
+		}
+	}
+}
+
+func TestOptimizeKeepsNonFiniteConstants(t *testing.T) {
+	tests := []struct {
+		source string
+		mode   NumericMode
+		want   string
+	}{
+		{"1e308 * 10", MixedMode, "1e308 * 10"},
+		{"1e308 * 10", FloatMode, "1e308 * 10"},
+		{"x + 1e308 * 10 * 0", FloatMode, "x + 1e308 * 10 * 0"},
+		{"-(1e308 * 10)", MixedMode, "-(1e308 * 10)"},
+		{"1e308 * 10", ExactMode, "1" + strings.Repeat("0", 309)},
+		{"1e300 * 10", MixedMode, "1e+301"},
+	}
+	for _, tt := range tests {
+		expr, err := (&Context{}).ParseProgram(tt.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		optimized := Optimize(expr, tt.mode)
+		if got := stringOf(optimized); got != tt.want {
+			t.Errorf("Optimize(%q, mode %d) = %q, want %q", tt.source, tt.mode, got, tt.want)
+			continue
+		}
+		checkPrinted(t, optimized, tt.mode)
+	}
+}
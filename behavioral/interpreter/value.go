@@ -0,0 +1,364 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Kind is a level of the numeric tower, or Boolean. When two numbers meet in
+// an operation the result has the higher kind: Integer < Rational < Float.
+type Kind int
+
+const (
+	Integer  Kind = iota // arbitrary precision, never overflows
+	Rational             // exact fraction
+	Float                // float64
+	Boolean              // result of a comparison, never mixed with numbers
+)
+
+// Value is a number of any kind or a boolean. The zero Value is the integer 0.
+type Value struct {
+	kind Kind
+	i    *big.Int
+	r    *big.Rat
+	f    float64
+	b    bool
+}
+
+func Int(n int64) Value {
+	return Value{kind: Integer, i: big.NewInt(n)}
+}
+
+func BigInt(n *big.Int) Value {
+	return Value{kind: Integer, i: new(big.Int).Set(n)}
+}
+
+// Rat returns the fraction a/b, which is an Integer if b divides a
+func Rat(a, b int64) Value {
+	return ratValue(big.NewRat(a, b))
+}
+
+func BigRat(r *big.Rat) Value {
+	return ratValue(new(big.Rat).Set(r))
+}
+
+func Float64(f float64) Value {
+	return Value{kind: Float, f: f}
+}
+
+func Bool(b bool) Value {
+	return Value{kind: Boolean, b: b}
+}
+
+// ratValue takes ownership of r and normalizes whole numbers to integers
+func ratValue(r *big.Rat) Value {
+	if r.IsInt() {
+		// r is not used again, so its numerator can be kept without a copy
+		return Value{kind: Integer, i: r.Num()}
+	}
+	return Value{kind: Rational, r: r}
+}
+
+var bigZero = new(big.Int)
+
+// integer returns an Integer's value without copying it; it must not be modified
+func (v Value) integer() *big.Int {
+	if v.i == nil {
+		return bigZero
+	}
+	return v.i
+}
+
+// rational returns the value of an Integer or Rational, sharing a Rational's
+// fraction instead of copying it; it must not be modified
+func (v Value) rational() *big.Rat {
+	if v.kind == Rational {
+		return v.r
+	}
+	return new(big.Rat).SetInt(v.integer())
+}
+
+func (v Value) Kind() Kind {
+	return v.kind
+}
+
+// Bool reports whether the value is the boolean true
+func (v Value) Bool() bool {
+	return v.kind == Boolean && v.b
+}
+
+// BigInt returns the value as an integer, truncating toward zero
+func (v Value) BigInt() *big.Int {
+	switch v.kind {
+	case Rational:
+		return new(big.Int).Quo(v.r.Num(), v.r.Denom())
+	case Float:
+		i, _ := big.NewFloat(v.f).Int(nil)
+		return i
+	}
+	return new(big.Int).Set(v.integer())
+}
+
+// Rat returns the exact value, or nil for a float that is infinite or NaN
+func (v Value) Rat() *big.Rat {
+	switch v.kind {
+	case Rational:
+		return new(big.Rat).Set(v.r)
+	case Float:
+		return new(big.Rat).SetFloat64(v.f)
+	}
+	return new(big.Rat).SetInt(v.integer())
+}
+
+// Float64 returns the nearest float64 to the value
+func (v Value) Float64() float64 {
+	switch v.kind {
+	case Rational:
+		f, _ := v.r.Float64()
+		return f
+	case Float:
+		return v.f
+	}
+	if i := v.integer(); i.IsInt64() {
+		return float64(i.Int64())
+	}
+	f, _ := new(big.Float).SetInt(v.integer()).Float64()
+	return f
+}
+
+// finite reports whether the value is not an infinite or NaN float, which no
+// literal can express
+func (v Value) finite() bool {
+	return v.kind != Float || !(math.IsInf(v.f, 0) || math.IsNaN(v.f))
+}
+
+func (v Value) String() string {
+	switch v.kind {
+	case Boolean:
+		return strconv.FormatBool(v.b)
+	case Rational:
+		return v.r.String()
+	case Float:
+		s := strconv.FormatFloat(v.f, 'g', -1, 64)
+		// Keep floats recognisable when they hold a whole number
+		if !strings.ContainsAny(s, ".eEnN") {
+			s += ".0"
+		}
+		return s
+	}
+	return v.integer().String()
+}
+
+// NumericMode selects how numbers are represented while interpreting
+type NumericMode int
+
+const (
+	// MixedMode keeps each value's kind. Dividing integers gives an exact
+	// rational, and anything combined with a float is a float.
+	MixedMode NumericMode = iota
+	// ExactMode never uses floats: decimal literals such as 0.1 are read as
+	// exact fractions.
+	ExactMode
+	// FloatMode computes everything in float64.
+	FloatMode
+	// IntegerMode uses only integers, and division truncates toward zero.
+	IntegerMode
+)
+
+// parseNumber reads an integer literal such as 42 or a decimal one such as 1.5e3
+func parseNumber(text string, pos int) (*Number, error) {
+	if strings.ContainsAny(text, ".eE") {
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, &SyntaxError{Pos: pos, Token: text, Msg: "invalid number"}
+		}
+		return &Number{value: Float64(f), text: text, pos: pos}, nil
+	}
+	i, ok := new(big.Int).SetString(text, 10)
+	if !ok {
+		return nil, &SyntaxError{Pos: pos, Token: text, Msg: "invalid number"}
+	}
+	return &Number{value: Value{kind: Integer, i: i}, pos: pos}, nil
+}
+
+// convert brings a value read from a literal or variable into the mode
+func (m NumericMode) convert(v Value) (Value, error) {
+	switch {
+	case v.kind == Boolean:
+		return v, nil
+	case m == FloatMode && v.kind != Float:
+		return Float64(v.Float64()), nil
+	case m == ExactMode && v.kind == Float:
+		r := v.Rat()
+		if r == nil {
+			return Value{}, ErrInexact
+		}
+		return ratValue(r), nil
+	case m == IntegerMode && v.kind != Integer:
+		return Value{}, ErrNotInteger
+	}
+	return v, nil
+}
+
+// binaryOp is a binary operator other than && and ||, looked up once so that
+// applying it does not compare strings
+type binaryOp byte
+
+const (
+	addOp binaryOp = iota
+	subOp
+	mulOp
+	divOp
+	eqOp
+	neOp
+	ltOp
+	leOp
+	gtOp
+	geOp
+)
+
+var binaryOpNames = [...]string{"+", "-", "*", "/", "==", "!=", "<", "<=", ">", ">="}
+
+func lookupBinaryOp(operator string) (binaryOp, bool) {
+	for op, name := range binaryOpNames {
+		if name == operator {
+			return binaryOp(op), true
+		}
+	}
+	return 0, false
+}
+
+func (op binaryOp) String() string {
+	return binaryOpNames[op]
+}
+
+// binary applies a binary operator to two values of the mode
+func binary(operator string, a, b Value, mode NumericMode) (Value, error) {
+	op, ok := lookupBinaryOp(operator)
+	if !ok {
+		return Value{}, ErrUnknownOperator
+	}
+	return op.apply(a, b, mode)
+}
+
+func (op binaryOp) apply(a, b Value, mode NumericMode) (Value, error) {
+	if op >= eqOp {
+		return comparison(op, a, b)
+	}
+	return arithmetic(op, a, b, mode)
+}
+
+func arithmetic(op binaryOp, a, b Value, mode NumericMode) (Value, error) {
+	if a.kind == Boolean || b.kind == Boolean {
+		return Value{}, ErrNotNumber
+	}
+	kind := max(a.kind, b.kind)
+	if op == divOp && kind == Integer && mode != IntegerMode {
+		// Integer division is exact unless the mode asks for truncation
+		kind = Rational
+	}
+	switch kind {
+	case Integer:
+		// The operands are shared with other values, so the result gets its own
+		x, y, z := a.integer(), b.integer(), new(big.Int)
+		switch op {
+		case addOp:
+			return Value{kind: Integer, i: z.Add(x, y)}, nil
+		case subOp:
+			return Value{kind: Integer, i: z.Sub(x, y)}, nil
+		case mulOp:
+			return Value{kind: Integer, i: z.Mul(x, y)}, nil
+		case divOp:
+			if y.Sign() == 0 {
+				return Value{}, ErrDivisionByZero
+			}
+			return Value{kind: Integer, i: z.Quo(x, y)}, nil
+		}
+	case Rational:
+		x, y, z := a.rational(), b.rational(), new(big.Rat)
+		switch op {
+		case addOp:
+			return ratValue(z.Add(x, y)), nil
+		case subOp:
+			return ratValue(z.Sub(x, y)), nil
+		case mulOp:
+			return ratValue(z.Mul(x, y)), nil
+		case divOp:
+			if y.Sign() == 0 {
+				return Value{}, ErrDivisionByZero
+			}
+			return ratValue(z.Quo(x, y)), nil
+		}
+	case Float:
+		return floatArithmetic(op, a.Float64(), b.Float64())
+	}
+	return Value{}, ErrUnknownOperator
+}
+
+func floatArithmetic(op binaryOp, x, y float64) (Value, error) {
+	switch op {
+	case addOp:
+		return Float64(x + y), nil
+	case subOp:
+		return Float64(x - y), nil
+	case mulOp:
+		return Float64(x * y), nil
+	case divOp:
+		if y == 0 {
+			return Value{}, ErrDivisionByZero
+		}
+		return Float64(x / y), nil
+	}
+	return Value{}, ErrUnknownOperator
+}
+
+func comparison(op binaryOp, a, b Value) (Value, error) {
+	if a.kind == Boolean && b.kind == Boolean {
+		switch op {
+		case eqOp:
+			return Bool(a.b == b.b), nil
+		case neOp:
+			return Bool(a.b != b.b), nil
+		}
+		return Value{}, ErrNotNumber
+	}
+	c, err := compare(a, b)
+	if err != nil {
+		return Value{}, err
+	}
+	return op.holds(c), nil
+}
+
+// holds reports whether a comparison operator accepts the result c of compare
+func (op binaryOp) holds(c int) Value {
+	switch op {
+	case eqOp:
+		return Bool(c == 0)
+	case neOp:
+		return Bool(c != 0)
+	case ltOp:
+		return Bool(c < 0)
+	case leOp:
+		return Bool(c <= 0)
+	case gtOp:
+		return Bool(c > 0)
+	}
+	return Bool(c >= 0)
+}
+
+// compare orders two numbers of any kind, returning -1, 0 or +1
+func compare(a, b Value) (int, error) {
+	if a.kind == Boolean || b.kind == Boolean {
+		return 0, ErrNotNumber
+	}
+	if a.kind == Float || b.kind == Float {
+		return cmp.Compare(a.Float64(), b.Float64()), nil
+	}
+	if a.kind == Integer && b.kind == Integer {
+		return a.integer().Cmp(b.integer()), nil
+	}
+	return a.rational().Cmp(b.rational()), nil
+}
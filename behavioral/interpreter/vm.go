@@ -0,0 +1,415 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type opcode byte
+
+const (
+	opConst  opcode = iota // push constant arg
+	opLoad                 // push the variable in slot arg
+	opSet                  // bind slot arg to the top value, leaving it in place
+	opDefine               // like opSet, and also define the variable in the environment
+	opAdd                  // replace the top two values with their sum
+	opSub                  // ... difference
+	opMul                  // ... product
+	opDiv                  // ... quotient
+	opEq                   // ... comparison
+	opNe
+	opLt
+	opLe
+	opGt
+	opGe
+	opNot    // negate the boolean on top
+	opBool   // check that the top value is a boolean
+	opPop    // discard the top value
+	opJump   // continue at instruction arg
+	opBranch // pop a boolean and continue at arg if it is false
+	opAnd    // if the top boolean is false continue at arg, else pop it
+	opOr     // if the top boolean is true continue at arg, else pop it
+	opFunc   // look up the function named arg
+	opCall   // call the function looked up last with the top arg values
+	opEnter  // save the slots that block arg defines
+	opLeave  // restore the slots saved by the matching opEnter
+)
+
+var opcodeNames = [...]string{
+	"const", "load", "set", "define",
+	"add", "sub", "mul", "div", "eq", "ne", "lt", "le", "gt", "ge",
+	"not", "bool", "pop", "jump", "branch", "and", "or", "func", "call", "enter", "leave",
+}
+
+type instruction struct {
+	op  opcode
+	arg int32
+}
+
+// source locates an instruction in the program text, for errors
+type source struct {
+	pos   int
+	token string
+}
+
+// constant is a literal as read in one numeric mode
+type constant struct {
+	value Value
+	err   error
+}
+
+// Bytecode is an expression compiled for a stack machine. It implements
+// Expression, and interpreting it gives the same results and errors as
+// interpreting the tree it was compiled from.
+//
+// Operators are resolved to opcodes, and every variable name to a slot, when
+// the expression is compiled. A slot holds the variable's value for one run: a
+// let fills it, and the first load of a variable that no let has set fills it
+// from the environment. Blocks save the slots they define and restore them
+// when they end, instead of creating a scope.
+type Bytecode struct {
+	code      []instruction
+	sources   []source
+	constants [IntegerMode + 1][]constant // indexed by NumericMode
+	vars      []string                    // variable names, by slot
+	funcs     []string                    // function names
+	blocks    [][]int32                   // the slots each block defines
+	maxStack  int
+}
+
+// Compile translates a syntax tree into bytecode
+func Compile(expr Expression) (*Bytecode, error) {
+	c := &compiler{Bytecode: &Bytecode{}, vars: make(map[string]int32), funcs: make(map[string]int32)}
+	if err := c.compile(expr); err != nil {
+		return nil, err
+	}
+	return c.Bytecode, nil
+}
+
+type compiler struct {
+	*Bytecode
+	vars  map[string]int32
+	funcs map[string]int32
+	open  []int // blocks being compiled, innermost last
+	depth int   // values on the stack at this point of the code
+}
+
+func (c *compiler) compile(expr Expression) error {
+	switch e := expr.(type) {
+	case *Number:
+		c.constant(func(mode NumericMode) (Value, error) { return e.valueIn(mode) })
+	case *Variable:
+		c.emit(opLoad, c.slot(e.name), source{e.pos, e.name})
+	case *Operation:
+		op, ok := lookupBinaryOp(e.operator)
+		if !ok {
+			return fmt.Errorf("compile operator %q: %w", e.operator, ErrUnknownOperator)
+		}
+		if err := c.compileAll(e.left, e.right); err != nil {
+			return err
+		}
+		c.emit(opAdd+opcode(op), 0, source{e.pos, e.operator})
+	case *Let:
+		if err := c.compile(e.value); err != nil {
+			return err
+		}
+		slot := c.slot(e.name)
+		if len(c.open) == 0 {
+			c.emit(opDefine, slot, source{})
+			break
+		}
+		block := c.open[len(c.open)-1]
+		if !slices.Contains(c.blocks[block], int32(slot)) {
+			c.blocks[block] = append(c.blocks[block], int32(slot))
+		}
+		c.emit(opSet, slot, source{})
+	case *Program:
+		if len(e.statements) == 0 {
+			// An empty program evaluates to the zero Value in every mode
+			c.constant(func(NumericMode) (Value, error) { return Value{}, nil })
+		}
+		for i, statement := range e.statements {
+			if i > 0 {
+				c.emit(opPop, 0, source{})
+			}
+			if err := c.compile(statement); err != nil {
+				return err
+			}
+		}
+	case *Block:
+		block := len(c.blocks)
+		c.blocks = append(c.blocks, nil)
+		c.open = append(c.open, block)
+		c.emit(opEnter, block, source{})
+		if err := c.compile(e.body); err != nil {
+			return err
+		}
+		c.emit(opLeave, block, source{})
+		c.open = c.open[:len(c.open)-1]
+	case *Call:
+		c.emit(opFunc, c.function(e.name), source{e.pos, e.name})
+		if err := c.compileAll(e.args...); err != nil {
+			return err
+		}
+		c.emit(opCall, len(e.args), source{e.pos, e.name})
+	case *Not:
+		if err := c.compile(e.operand); err != nil {
+			return err
+		}
+		c.emit(opNot, 0, source{e.pos, "!"})
+	case *Logical:
+		op := opAnd
+		if e.operator == "||" {
+			op = opOr
+		}
+		if err := c.compile(e.left); err != nil {
+			return err
+		}
+		jump := c.emit(op, 0, source{e.pos, e.operator})
+		if err := c.compile(e.right); err != nil {
+			return err
+		}
+		c.emit(opBool, 0, source{e.pos, e.operator})
+		c.patch(jump)
+	case *If:
+		if err := c.compile(e.cond); err != nil {
+			return err
+		}
+		branch := c.emit(opBranch, 0, source{e.pos, "if"})
+		if err := c.compile(e.then); err != nil {
+			return err
+		}
+		jump := c.emit(opJump, 0, source{})
+		c.depth-- // the else branch starts without the then branch's value
+		c.patch(branch)
+		if err := c.compile(e.otherwise); err != nil {
+			return err
+		}
+		c.patch(jump)
+	default:
+		return fmt.Errorf("compile %T: %w", expr, ErrNotCompilable)
+	}
+	return nil
+}
+
+func (c *compiler) compileAll(exprs ...Expression) error {
+	for _, expr := range exprs {
+		if err := c.compile(expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// constant pushes a value that depends on the numeric mode
+func (c *compiler) constant(valueIn func(NumericMode) (Value, error)) {
+	for mode := range c.constants {
+		value, err := valueIn(NumericMode(mode))
+		c.constants[mode] = append(c.constants[mode], constant{value: value, err: err})
+	}
+	c.emit(opConst, len(c.constants[0])-1, source{})
+}
+
+// emit appends an instruction and returns its index
+func (c *compiler) emit(op opcode, arg int, src source) int {
+	switch {
+	case op == opConst || op == opLoad:
+		c.depth++
+	case op >= opAdd && op <= opGe, op == opPop, op == opBranch, op == opAnd, op == opOr:
+		c.depth--
+	case op == opCall:
+		c.depth -= arg - 1
+	}
+	c.maxStack = max(c.maxStack, c.depth)
+	c.code = append(c.code, instruction{op: op, arg: int32(arg)})
+	c.sources = append(c.sources, src)
+	return len(c.code) - 1
+}
+
+// patch points a jump at the next instruction
+func (c *compiler) patch(jump int) {
+	c.code[jump].arg = int32(len(c.code))
+}
+
+// slot returns the slot of a variable
+func (c *compiler) slot(name string) int {
+	return intern(c.vars, &c.Bytecode.vars, name)
+}
+
+func (c *compiler) function(name string) int {
+	return intern(c.funcs, &c.Bytecode.funcs, name)
+}
+
+// intern returns the index of name in names, adding it if needed
+func intern(index map[string]int32, names *[]string, name string) int {
+	i, ok := index[name]
+	if !ok {
+		i = int32(len(*names))
+		index[name] = i
+		*names = append(*names, name)
+	}
+	return int(i)
+}
+
+// local is a variable slot; ok is false until the variable is first set or read
+type local struct {
+	value Value
+	ok    bool
+}
+
+func (b *Bytecode) Interpret(env *Environment) (Value, error) {
+	mode := env.Mode()
+	constants := b.constants[MixedMode]
+	if int(mode) < len(b.constants) {
+		constants = b.constants[mode]
+	}
+	// Most expressions need only a few slots, which then stay off the heap
+	var stackSlots [8]Value
+	stack := stackSlots[:0]
+	if b.maxStack > len(stackSlots) {
+		stack = make([]Value, 0, b.maxStack)
+	}
+	var localSlots [8]local
+	locals := localSlots[:]
+	if len(b.vars) > len(localSlots) {
+		locals = make([]local, len(b.vars))
+	}
+	var funcSlots [4]Function
+	funcs := funcSlots[:0]
+	var saved []local // slots shadowed by the blocks being run
+	for pc := 0; pc < len(b.code); pc++ {
+		in := b.code[pc]
+		switch in.op {
+		case opConst:
+			c := constants[in.arg]
+			if c.err != nil {
+				return Value{}, c.err
+			}
+			stack = append(stack, c.value)
+		case opLoad:
+			l := &locals[in.arg]
+			if !l.ok {
+				// Not set by a let, so it comes from the environment, which
+				// only this run changes
+				src := b.sources[pc]
+				value, err := load(env, src.token, src.pos)
+				if err != nil {
+					return Value{}, err
+				}
+				*l = local{value: value, ok: true}
+			}
+			stack = append(stack, l.value)
+		case opSet:
+			locals[in.arg] = local{value: stack[len(stack)-1], ok: true}
+		case opDefine:
+			value := stack[len(stack)-1]
+			locals[in.arg] = local{value: value, ok: true}
+			env.Define(b.vars[in.arg], value)
+		case opAdd, opSub, opMul, opDiv, opEq, opNe, opLt, opLe, opGt, opGe:
+			top := len(stack) - 1
+			x, y := stack[top-1], stack[top]
+			op := binaryOp(in.op - opAdd)
+			var result Value
+			var err error
+			switch {
+			case x.kind != Float || y.kind != Float:
+				result, err = op.apply(x, y, mode)
+			case op >= eqOp:
+				result = op.holds(cmp.Compare(x.f, y.f))
+			default:
+				result, err = floatArithmetic(op, x.f, y.f)
+			}
+			if err != nil {
+				return Value{}, b.error(pc, err)
+			}
+			stack[top-1] = result
+			stack = stack[:top]
+		case opNot, opBool, opBranch, opAnd, opOr:
+			top := len(stack) - 1
+			if stack[top].kind != Boolean {
+				return Value{}, b.error(pc, ErrNotBoolean)
+			}
+			switch in.op {
+			case opNot:
+				stack[top] = Bool(!stack[top].b)
+			case opBranch:
+				if !stack[top].b {
+					pc = int(in.arg) - 1
+				}
+				stack = stack[:top]
+			case opAnd, opOr:
+				if stack[top].b == (in.op == opOr) {
+					pc = int(in.arg) - 1
+				} else {
+					stack = stack[:top]
+				}
+			}
+		case opPop:
+			stack = stack[:len(stack)-1]
+		case opJump:
+			pc = int(in.arg) - 1
+		case opFunc:
+			fn, ok := env.Func(b.funcs[in.arg])
+			if !ok {
+				return Value{}, b.error(pc, ErrUndefinedFunction)
+			}
+			funcs = append(funcs, fn)
+		case opCall:
+			fn := funcs[len(funcs)-1]
+			funcs = funcs[:len(funcs)-1]
+			first := len(stack) - int(in.arg)
+			src := b.sources[pc]
+			// Functions get their own copy, as they may keep their arguments
+			result, err := call(env, fn, slices.Clone(stack[first:]), src.token, src.pos)
+			if err != nil {
+				return Value{}, err
+			}
+			stack = append(stack[:first], result)
+		case opEnter:
+			for _, slot := range b.blocks[in.arg] {
+				saved = append(saved, locals[slot])
+			}
+		case opLeave:
+			slots := b.blocks[in.arg]
+			for i := len(slots) - 1; i >= 0; i-- {
+				locals[slots[i]] = saved[len(saved)-1]
+				saved = saved[:len(saved)-1]
+			}
+		}
+	}
+	return stack[0], nil
+}
+
+func (b *Bytecode) error(pc int, err error) error {
+	src := b.sources[pc]
+	return &EvalError{Pos: src.pos, Token: src.token, Err: err}
+}
+
+// String disassembles the bytecode, one instruction per line
+func (b *Bytecode) String() string {
+	var sb strings.Builder
+	for pc, in := range b.code {
+		var arg string
+		switch in.op {
+		case opConst:
+			arg = b.constants[MixedMode][in.arg].value.String()
+		case opLoad, opSet, opDefine:
+			arg = b.vars[in.arg]
+		case opFunc:
+			arg = b.funcs[in.arg]
+		case opEnter, opLeave:
+			names := make([]string, len(b.blocks[in.arg]))
+			for i, slot := range b.blocks[in.arg] {
+				names[i] = b.vars[slot]
+			}
+			arg = strings.Join(names, " ")
+		case opJump, opBranch, opAnd, opOr, opCall:
+			arg = fmt.Sprint(in.arg)
+		}
+		line := fmt.Sprintf("%04d %-6s %s", pc, opcodeNames[in.op], arg)
+		sb.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return sb.String()
+}
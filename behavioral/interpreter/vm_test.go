@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// checkCompiled interprets a random program both as a tree and as bytecode,
+// in every numeric mode, and fails if the results or errors differ
+func checkCompiled(t *testing.T, seed int64) {
+	program := randomProgram(rand.New(rand.NewSource(seed)))
+	code, err := Compile(program)
+	if err != nil {
+		t.Fatalf("seed %d: %v", seed, err)
+	}
+	for mode := MixedMode; mode <= IntegerMode; mode++ {
+		treeEnv, codeEnv := checkEnvironment(mode), checkEnvironment(mode)
+		want, wantErr := program.Interpret(treeEnv)
+		got, gotErr := code.Interpret(codeEnv)
+		if fmt.Sprint(want, wantErr) != fmt.Sprint(got, gotErr) || want.kind != got.kind {
+			t.Fatalf("seed %d in mode %d: tree gives %v (%v), bytecode gives %v (%v)\n%s",
+				seed, mode, want, wantErr, got, gotErr, code)
+		}
+		// Top-level lets stay defined after the run
+		for _, name := range []string{"x", "y", "z", "ok", "w"} {
+			want, _ := treeEnv.Get(name)
+			got, _ := codeEnv.Get(name)
+			if fmt.Sprint(want) != fmt.Sprint(got) {
+				t.Fatalf("seed %d in mode %d: %s is %v after the tree, %v after the bytecode\n%s",
+					seed, mode, name, want, got, code)
+			}
+		}
+	}
+}
+
+func TestCompilerMatchesTree(t *testing.T) {
+	n := int64(20000)
+	if testing.Short() {
+		n = 1000
+	}
+	for seed := int64(0); seed < n; seed++ {
+		checkCompiled(t, seed)
+	}
+}
+
+func FuzzCompile(f *testing.F) {
+	f.Add(int64(0))
+	f.Fuzz(checkCompiled)
+}
+
+func checkEnvironment(mode NumericMode) *Environment {
+	env := NewEnvironment(nil)
+	env.SetMode(mode)
+	env.Define("x", Int(7))
+	env.Define("y", Rat(-3, 4))
+	env.Define("z", Float64(2.5))
+	env.Define("ok", Bool(true))
+	return env
+}
+
+// randomProgram builds statements that use every kind of node, including
+// ones that fail: undefined names, division by zero and mixed types
+func randomProgram(r *rand.Rand) *Program {
+	program := &Program{}
+	for i := r.Intn(3); i >= 0; i-- {
+		expr := randomExpression(r, 4)
+		if r.Intn(3) == 0 {
+			expr = &Let{name: randomName(r), value: expr}
+		}
+		program.statements = append(program.statements, expr)
+	}
+	return program
+}
+
+func randomExpression(r *rand.Rand, depth int) Expression {
+	pos := r.Intn(100)
+	if depth == 0 || r.Intn(4) == 0 {
+		switch r.Intn(4) {
+		case 0:
+			return &Variable{name: randomName(r), pos: pos}
+		case 1:
+			return &Number{value: Bool(r.Intn(2) == 0), pos: pos}
+		case 2:
+			text := fmt.Sprintf("%d.%d", r.Intn(10), r.Intn(10))
+			number, _ := parseNumber(text, pos)
+			return number
+		}
+		return &Number{value: Int(int64(r.Intn(11) - 5)), pos: pos}
+	}
+	operand := func() Expression { return randomExpression(r, depth-1) }
+	switch r.Intn(8) {
+	case 0:
+		return &Not{operand: operand(), pos: pos}
+	case 1:
+		return &Logical{left: operand(), right: operand(), operator: []string{"&&", "||"}[r.Intn(2)], pos: pos}
+	case 2:
+		return &If{cond: operand(), then: operand(), otherwise: operand(), pos: pos}
+	case 3:
+		call := &Call{name: []string{"min", "max", "abs", "pow", "nope"}[r.Intn(5)], pos: pos}
+		for i := r.Intn(3); i >= 0; i-- {
+			call.args = append(call.args, operand())
+		}
+		return call
+	case 4:
+		return &Block{body: &Program{statements: []Expression{&Let{name: randomName(r), value: operand()}, operand()}}}
+	}
+	operators := []string{"+", "-", "*", "/", "==", "!=", "<", "<=", ">", ">="}
+	return &Operation{left: operand(), right: operand(), operator: operators[r.Intn(len(operators))], pos: pos}
+}
+
+func randomName(r *rand.Rand) string {
+	return []string{"x", "y", "z", "ok", "w"}[r.Intn(5)]
+}
+
+// A billing formula that uses every kind of node except blocks
+const benchFormula = "let total = price * quantity; let discounted = if(total > 50 && quantity >= 2, total * 9 / 10, total); (discounted + 5) * (1 + 0.075) - (quantity - 1) * 2 + max(0, discounted - 100) / 4"
+
+func benchmarkInterpret(b *testing.B, compile bool) {
+	for _, mode := range []NumericMode{MixedMode, ExactMode, FloatMode} {
+		b.Run(fmt.Sprint("mode", mode), func(b *testing.B) {
+			program, err := (&Context{}).ParseProgram(benchFormula)
+			if err != nil {
+				b.Fatal(err)
+			}
+			var expr Expression = program
+			if compile {
+				if expr, err = Compile(program); err != nil {
+					b.Fatal(err)
+				}
+			}
+			env := NewEnvironment(nil)
+			env.SetMode(mode)
+			env.Define("price", Rat(1999, 100))
+			env.Define("quantity", Int(3))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := expr.Interpret(env); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTree(b *testing.B) {
+	benchmarkInterpret(b, false)
+}
+
+func BenchmarkBytecode(b *testing.B) {
+	benchmarkInterpret(b, true)
+}
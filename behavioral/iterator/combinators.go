@@ -0,0 +1,210 @@
+package main
+
+// The functions below wrap iterators in other iterators. They are lazy: an
+// element is read from the source only when the result needs it, so they work
+// on long or endless sources and stop reading as soon as the caller does.
+
+// Map applies f to every element
+func Map[T, U any](source Iterator[T], f func(T) U) Iterator[U] {
+	return &mapIterator[T, U]{source: source, f: f}
+}
+
+type mapIterator[T, U any] struct {
+	source Iterator[T]
+	f      func(T) U
+}
+
+func (mi *mapIterator[T, U]) HasNext() bool {
+	return mi.source.HasNext()
+}
+
+func (mi *mapIterator[T, U]) Next() U {
+	if !mi.HasNext() {
+		var zero U
+		return zero
+	}
+	return mi.f(mi.source.Next())
+}
+
+// Filter keeps the elements for which keep returns true
+func Filter[T any](source Iterator[T], keep func(T) bool) Iterator[T] {
+	return &filterIterator[T]{source: source, keep: keep}
+}
+
+type filterIterator[T any] struct {
+	source Iterator[T]
+	keep   func(T) bool
+	next   T
+	ready  bool // next holds an element that was kept
+}
+
+func (fi *filterIterator[T]) HasNext() bool {
+	for !fi.ready && fi.source.HasNext() {
+		fi.next = fi.source.Next()
+		fi.ready = fi.keep(fi.next)
+	}
+	return fi.ready
+}
+
+func (fi *filterIterator[T]) Next() T {
+	var zero T
+	if !fi.HasNext() {
+		return zero
+	}
+	next := fi.next
+	fi.next, fi.ready = zero, false
+	return next
+}
+
+// Take stops after the first n elements
+func Take[T any](source Iterator[T], n int) Iterator[T] {
+	return &takeIterator[T]{source: source, n: n}
+}
+
+type takeIterator[T any] struct {
+	source Iterator[T]
+	n      int // elements left to take
+}
+
+func (ti *takeIterator[T]) HasNext() bool {
+	return ti.n > 0 && ti.source.HasNext()
+}
+
+func (ti *takeIterator[T]) Next() T {
+	if !ti.HasNext() {
+		var zero T
+		return zero
+	}
+	ti.n--
+	return ti.source.Next()
+}
+
+// Skip drops the first n elements
+func Skip[T any](source Iterator[T], n int) Iterator[T] {
+	return &skipIterator[T]{source: source, n: n}
+}
+
+type skipIterator[T any] struct {
+	source Iterator[T]
+	n      int // elements left to skip
+}
+
+func (si *skipIterator[T]) HasNext() bool {
+	for ; si.n > 0 && si.source.HasNext(); si.n-- {
+		si.source.Next()
+	}
+	return si.source.HasNext()
+}
+
+func (si *skipIterator[T]) Next() T {
+	if !si.HasNext() {
+		var zero T
+		return zero
+	}
+	return si.source.Next()
+}
+
+// Pair holds one element from each iterator given to Zip
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+// Zip pairs up the elements of two iterators, stopping when either runs out
+func Zip[A, B any](first Iterator[A], second Iterator[B]) Iterator[Pair[A, B]] {
+	return &zipIterator[A, B]{first: first, second: second}
+}
+
+type zipIterator[A, B any] struct {
+	first  Iterator[A]
+	second Iterator[B]
+}
+
+func (zi *zipIterator[A, B]) HasNext() bool {
+	return zi.first.HasNext() && zi.second.HasNext()
+}
+
+func (zi *zipIterator[A, B]) Next() Pair[A, B] {
+	if !zi.HasNext() {
+		return Pair[A, B]{}
+	}
+	return Pair[A, B]{First: zi.first.Next(), Second: zi.second.Next()}
+}
+
+// Chain yields the elements of each iterator in turn
+func Chain[T any](sources ...Iterator[T]) Iterator[T] {
+	return &chainIterator[T]{sources: sources}
+}
+
+type chainIterator[T any] struct {
+	sources []Iterator[T]
+}
+
+func (ci *chainIterator[T]) HasNext() bool {
+	for len(ci.sources) > 0 && !ci.sources[0].HasNext() {
+		ci.sources = ci.sources[1:]
+	}
+	return len(ci.sources) > 0
+}
+
+func (ci *chainIterator[T]) Next() T {
+	if !ci.HasNext() {
+		var zero T
+		return zero
+	}
+	return ci.sources[0].Next()
+}
+
+// Chunk groups the elements into slices of size elements; the last one may be
+// shorter. A size less than 1 yields nothing, as Take does for n less than 1.
+func Chunk[T any](source Iterator[T], size int) Iterator[[]T] {
+	return &chunkIterator[T]{source: source, size: size}
+}
+
+type chunkIterator[T any] struct {
+	source Iterator[T]
+	size   int
+}
+
+func (ci *chunkIterator[T]) HasNext() bool {
+	return ci.size > 0 && ci.source.HasNext()
+}
+
+func (ci *chunkIterator[T]) Next() []T {
+	if !ci.HasNext() {
+		return nil
+	}
+	var chunk []T
+	for len(chunk) < ci.size && ci.source.HasNext() {
+		chunk = append(chunk, ci.source.Next())
+	}
+	return chunk
+}
+
+// Collect reads the remaining elements into a slice
+func Collect[T any](source Iterator[T]) []T {
+	var items []T
+	for source.HasNext() {
+		items = append(items, source.Next())
+	}
+	return items
+}
+
+// Reduce combines the remaining elements into one value, starting from initial
+func Reduce[T, A any](source Iterator[T], initial A, f func(A, T) A) A {
+	result := initial
+	for source.HasNext() {
+		result = f(result, source.Next())
+	}
+	return result
+}
+
+// Count reads the remaining elements and returns how many there were
+func Count[T any](source Iterator[T]) int {
+	n := 0
+	for source.HasNext() {
+		source.Next()
+		n++
+	}
+	return n
+}
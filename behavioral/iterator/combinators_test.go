@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// naturals yields 0, 1, 2, ... without end and counts how many it has yielded
+type naturals struct {
+	pulled int
+}
+
+func (n *naturals) HasNext() bool {
+	return true
+}
+
+func (n *naturals) Next() int {
+	n.pulled++
+	return n.pulled - 1
+}
+
+func sliceOf[T any](items ...T) Iterator[T] {
+	return (&SliceCollection[T]{items: items}).CreateIterator()
+}
+
+func isEven(n int) bool {
+	return n%2 == 0
+}
+
+func TestCombinatorsAreLazy(t *testing.T) {
+	tests := []struct {
+		name       string
+		build      func(source Iterator[int]) Iterator[int]
+		want       []int
+		wantPulled int
+	}{
+		{"take", func(s Iterator[int]) Iterator[int] { return Take(s, 3) }, []int{0, 1, 2}, 3},
+		{"take none", func(s Iterator[int]) Iterator[int] { return Take(s, 0) }, nil, 0},
+		{"filter then take", func(s Iterator[int]) Iterator[int] { return Take(Filter(s, isEven), 3) }, []int{0, 2, 4}, 5},
+		{"map then take", func(s Iterator[int]) Iterator[int] {
+			return Take(Map(s, func(n int) int { return n * n }), 4)
+		}, []int{0, 1, 4, 9}, 4},
+		{"skip then take", func(s Iterator[int]) Iterator[int] { return Take(Skip(s, 10), 2) }, []int{10, 11}, 12},
+		{"chain after a finite source", func(s Iterator[int]) Iterator[int] {
+			return Take(Chain(sliceOf(-2, -1), s), 4)
+		}, []int{-2, -1, 0, 1}, 2},
+		{"zip with a shorter source", func(s Iterator[int]) Iterator[int] {
+			return Map(Zip(s, sliceOf("a", "b")), func(p Pair[int, string]) int { return p.First })
+		}, []int{0, 1}, 2},
+		{"chunk then take", func(s Iterator[int]) Iterator[int] {
+			return Map(Take(Chunk(s, 3), 2), func(chunk []int) int { return chunk[len(chunk)-1] })
+		}, []int{2, 5}, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &naturals{}
+			result := tt.build(source)
+			if source.pulled != 0 {
+				t.Fatalf("building the iterator read %d elements", source.pulled)
+			}
+			if got := Collect(result); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if source.pulled != tt.wantPulled {
+				t.Errorf("read %d elements from the source, want %d", source.pulled, tt.wantPulled)
+			}
+		})
+	}
+}
+
+func TestCombinators(t *testing.T) {
+	digits := func() Iterator[int] { return sliceOf(1, 2, 3, 4, 5, 6, 7) }
+	tests := []struct {
+		name string
+		got  []int
+		want []int
+	}{
+		{"filter", Collect(Filter(digits(), isEven)), []int{2, 4, 6}},
+		{"filter everything out", Collect(Filter(digits(), func(int) bool { return false })), nil},
+		{"take more than there is", Collect(Take(digits(), 10)), []int{1, 2, 3, 4, 5, 6, 7}},
+		{"take a negative count", Collect(Take(digits(), -1)), nil},
+		{"skip", Collect(Skip(digits(), 5)), []int{6, 7}},
+		{"skip more than there is", Collect(Skip(digits(), 10)), nil},
+		{"chain with empty sources", Collect(Chain(sliceOf[int](), digits(), sliceOf[int](), sliceOf(8))), []int{1, 2, 3, 4, 5, 6, 7, 8}},
+		{"chain of nothing", Collect(Chain[int]()), nil},
+	}
+	for _, tt := range tests {
+		if !slices.Equal(tt.got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if got := Reduce(digits(), 0, func(sum, n int) int { return sum + n }); got != 28 {
+		t.Errorf("Reduce = %d, want 28", got)
+	}
+	if got := Count(Filter(digits(), isEven)); got != 3 {
+		t.Errorf("Count = %d, want 3", got)
+	}
+	pairs := Collect(Zip(digits(), sliceOf("a", "b")))
+	if want := []Pair[int, string]{{1, "a"}, {2, "b"}}; !slices.Equal(pairs, want) {
+		t.Errorf("Zip = %v, want %v", pairs, want)
+	}
+}
+
+func TestChunk(t *testing.T) {
+	tests := []struct {
+		size int
+		want string
+	}{
+		{-1, "[]"},
+		{0, "[]"},
+		{1, "[[1] [2] [3] [4] [5]]"},
+		{2, "[[1 2] [3 4] [5]]"},
+		{5, "[[1 2 3 4 5]]"},
+		{9, "[[1 2 3 4 5]]"},
+	}
+	for _, tt := range tests {
+		source := sliceOf(1, 2, 3, 4, 5)
+		if got := fmt.Sprint(Collect(Chunk(source, tt.size))); got != tt.want {
+			t.Errorf("Chunk(size %d) = %s, want %s", tt.size, got, tt.want)
+		}
+		if tt.size < 1 && !source.HasNext() {
+			t.Errorf("Chunk(size %d) read from its source", tt.size)
+		}
+	}
+	if got := Collect(Chunk(sliceOf[int](), 3)); got != nil {
+		t.Errorf("chunks of an empty source: %v", got)
+	}
+}
+
+func TestExhaustedIteratorsYieldZero(t *testing.T) {
+	iterators := map[string]Iterator[int]{
+		"map":    Map(sliceOf[int](), func(n int) int { return n + 1 }),
+		"filter": Filter(sliceOf(1), isEven),
+		"take":   Take(sliceOf(1), 0),
+		"skip":   Skip(sliceOf(1), 1),
+		"chain":  Chain(sliceOf[int]()),
+	}
+	for name, it := range iterators {
+		if it.HasNext() {
+			t.Errorf("%s: HasNext on an empty iterator", name)
+		}
+		if got := it.Next(); got != 0 {
+			t.Errorf("%s: Next = %d after the end, want 0", name, got)
+		}
+	}
+	if got := Chunk(sliceOf[int](), 2).Next(); got != nil {
+		t.Errorf("chunk: Next = %v after the end, want nil", got)
+	}
+	if got := Zip(sliceOf(1), sliceOf[string]()).Next(); got != (Pair[int, string]{}) {
+		t.Errorf("zip: Next = %v after the end, want the zero Pair", got)
+	}
+}
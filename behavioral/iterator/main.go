@@ -1,6 +1,11 @@
 package main
 
-import "fmt"
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
 
 type UserProfile struct {
 	ID   int
@@ -8,89 +13,141 @@ type UserProfile struct {
 }
 
 // Aggregate interface
-type UserProfileCollection interface {
-	CreateIterator() Iterator
+type Collection[T any] interface {
+	CreateIterator() Iterator[T]
 }
 
-// Iterator interface
-type Iterator interface {
+// Iterator interface. Next returns the zero value of T once the iterator is
+// exhausted.
+type Iterator[T any] interface {
 	HasNext() bool
-	Next() *UserProfile
+	Next() T
 }
 
+type UserProfileCollection = Collection[*UserProfile]
+
 // Concrete Aggregate: Slice
-type UserProfileSlice struct {
-	profiles []UserProfile
+type SliceCollection[T any] struct {
+	items []T
 }
 
-func (us *UserProfileSlice) CreateIterator() Iterator {
-	return &SliceIterator{profiles: us.profiles, index: 0}
+func (sc *SliceCollection[T]) CreateIterator() Iterator[T] {
+	return &SliceIterator[T]{items: sc.items, index: 0}
 }
 
-type SliceIterator struct {
-	profiles []UserProfile
-	index    int
+type SliceIterator[T any] struct {
+	items []T
+	index int
 }
 
-func (si *SliceIterator) HasNext() bool {
-	return si.index < len(si.profiles)
+func (si *SliceIterator[T]) HasNext() bool {
+	return si.index < len(si.items)
 }
 
-func (si *SliceIterator) Next() *UserProfile {
+func (si *SliceIterator[T]) Next() T {
+	var item T
 	if si.HasNext() {
-		profile := &si.profiles[si.index]
+		item = si.items[si.index]
 		si.index++
-		return profile
 	}
-	return nil
+	return item
 }
 
-// Concrete Aggregate: Map
-type UserProfileMap struct {
-	profiles map[int]UserProfile
-	keys     []int
+type UserProfileSlice = SliceCollection[*UserProfile]
+
+// Concrete Aggregate: Map. Iteration is ordered by key.
+type MapCollection[K cmp.Ordered, V any] struct {
+	items map[K]V
 }
 
-func (um *UserProfileMap) CreateIterator() Iterator {
-	keys := make([]int, 0, len(um.profiles))
-	for k := range um.profiles {
+func (mc *MapCollection[K, V]) CreateIterator() Iterator[V] {
+	return mc.CreateSortedIterator(nil)
+}
+
+// CreateSortedIterator iterates in the order given by compare, which returns
+// a negative number, zero or a positive number as a sorts before, with or
+// after b. Items that compare equal are ordered by key. A nil compare orders
+// by key alone.
+func (mc *MapCollection[K, V]) CreateSortedIterator(compare func(a, b V) int) Iterator[V] {
+	keys := make([]K, 0, len(mc.items))
+	for k := range mc.items {
 		keys = append(keys, k)
 	}
-	return &MapIterator{profiles: um.profiles, keys: keys, index: 0}
+	slices.Sort(keys)
+	if compare != nil {
+		slices.SortStableFunc(keys, func(a, b K) int {
+			return compare(mc.items[a], mc.items[b])
+		})
+	}
+	return snapshot(mc.items, keys)
 }
 
-type MapIterator struct {
-	profiles map[int]UserProfile
-	keys     []int
-	index    int
+// Concrete Aggregate: insertion-ordered map. Iteration follows the order in
+// which keys were first set; updating a key keeps its place, and a key that
+// is deleted and set again moves to the end.
+type OrderedMapCollection[K comparable, V any] struct {
+	items map[K]V
+	keys  []K
+}
+
+func (om *OrderedMapCollection[K, V]) Set(key K, value V) {
+	if om.items == nil {
+		om.items = make(map[K]V)
+	}
+	if _, ok := om.items[key]; !ok {
+		om.keys = append(om.keys, key)
+	}
+	om.items[key] = value
 }
 
-func (mi *MapIterator) HasNext() bool {
-	return mi.index < len(mi.keys)
+func (om *OrderedMapCollection[K, V]) Get(key K) (V, bool) {
+	value, ok := om.items[key]
+	return value, ok
 }
 
-func (mi *MapIterator) Next() *UserProfile {
-	if mi.HasNext() {
-		key := mi.keys[mi.index]
-		profile := mi.profiles[key]
-		mi.index++
-		return &profile
+func (om *OrderedMapCollection[K, V]) Delete(key K) {
+	if _, ok := om.items[key]; !ok {
+		return
 	}
-	return nil
+	delete(om.items, key)
+	om.keys = slices.DeleteFunc(om.keys, func(k K) bool { return k == key })
 }
 
+func (om *OrderedMapCollection[K, V]) Len() int {
+	return len(om.keys)
+}
+
+func (om *OrderedMapCollection[K, V]) CreateIterator() Iterator[V] {
+	return snapshot(om.items, om.keys)
+}
+
+// snapshot copies the values of keys in order, so that an iterator over a map
+// is not affected by later changes to it
+func snapshot[K comparable, V any](items map[K]V, keys []K) Iterator[V] {
+	values := make([]V, len(keys))
+	for i, k := range keys {
+		values[i] = items[k]
+	}
+	return &SliceIterator[V]{items: values, index: 0}
+}
+
+type UserProfileMap = MapCollection[int, *UserProfile]
+
+type OrderedUserProfileMap = OrderedMapCollection[int, *UserProfile]
+
 func main() {
 	sliceData := &UserProfileSlice{
-		profiles: []UserProfile{
+		items: []*UserProfile{
 			{ID: 1, Name: "Alice"},
 			{ID: 2, Name: "Bob"},
 		},
 	}
 
 	mapData := &UserProfileMap{
-		profiles: map[int]UserProfile{
-			3: {ID: 3, Name: "Charlie"},
+		items: map[int]*UserProfile{
 			4: {ID: 4, Name: "Dave"},
+			3: {ID: 3, Name: "Charlie"},
+			5: {ID: 5, Name: "Bea"},
 		},
 	}
 
@@ -107,4 +164,49 @@ func main() {
 	for iterator.HasNext() {
 		fmt.Println(iterator.Next())
 	}
+
+	// Iterating over map by name instead of by key
+	iterator = mapData.CreateSortedIterator(func(a, b *UserProfile) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	fmt.Println("\nIterating over map by name:")
+	for iterator.HasNext() {
+		fmt.Println(iterator.Next())
+	}
+
+	// Iterating over an insertion-ordered map
+	var recent OrderedUserProfileMap
+	recent.Set(9, &UserProfile{ID: 9, Name: "Zoe"})
+	recent.Set(2, &UserProfile{ID: 2, Name: "Bob"})
+	recent.Set(7, &UserProfile{ID: 7, Name: "Yann"})
+	recent.Set(9, &UserProfile{ID: 9, Name: "Zoe B."}) // keeps its place
+	recent.Delete(2)
+	recent.Set(2, &UserProfile{ID: 2, Name: "Bob"}) // moves to the end
+	iterator = recent.CreateIterator()
+	recent.Delete(9) // the iterator already holds its own copy
+	fmt.Println("\nIterating over insertion-ordered map:")
+	for iterator.HasNext() {
+		fmt.Println(iterator.Next())
+	}
+
+	// Combinators are lazy: nothing is read until the chain is consumed
+	collections := []UserProfileCollection{sliceData, mapData}
+	all := Chain(collections[0].CreateIterator(), collections[1].CreateIterator())
+	names := Map(Filter(all, func(p *UserProfile) bool { return p.ID%2 == 0 }),
+		func(p *UserProfile) string { return p.Name })
+	fmt.Println("\nEven IDs:", Collect(names))
+
+	ids := Map(sliceData.CreateIterator(), func(p *UserProfile) int { return p.ID })
+	total := Reduce(ids, 0, func(sum, id int) int { return sum + id })
+	fmt.Println("Sum of slice IDs:", total)
+
+	letters := &SliceCollection[string]{items: []string{"a", "b", "c", "d", "e", "f", "g"}}
+	fmt.Println("Chunks:", Collect(Chunk(Take(Skip(letters.CreateIterator(), 1), 5), 2)))
+
+	pairs := Zip(sliceData.CreateIterator(), letters.CreateIterator())
+	for pairs.HasNext() {
+		pair := pairs.Next()
+		fmt.Println(pair.First.Name, pair.Second)
+	}
+	fmt.Println("Profiles in the map:", Count(mapData.CreateIterator()))
 }
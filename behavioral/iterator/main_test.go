@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func names(it Iterator[*UserProfile]) string {
+	return strings.Join(Collect(Map(it, func(p *UserProfile) string { return p.Name })), " ")
+}
+
+func TestMapCollectionOrder(t *testing.T) {
+	profiles := &UserProfileMap{items: map[int]*UserProfile{
+		4: {ID: 4, Name: "Dave"},
+		3: {ID: 3, Name: "Charlie"},
+		5: {ID: 5, Name: "Bea"},
+		1: {ID: 1, Name: "Bea"},
+		2: {ID: 2, Name: "Alice"},
+	}}
+	byName := func(a, b *UserProfile) int { return strings.Compare(a.Name, b.Name) }
+	tests := []struct {
+		name string
+		it   func() Iterator[*UserProfile]
+		want string
+	}{
+		{"by key", profiles.CreateIterator, "Bea Alice Charlie Dave Bea"},
+		{"nil comparator", func() Iterator[*UserProfile] { return profiles.CreateSortedIterator(nil) }, "Bea Alice Charlie Dave Bea"},
+		// The two Beas stay in key order
+		{"by name", func() Iterator[*UserProfile] { return profiles.CreateSortedIterator(byName) }, "Alice Bea Bea Charlie Dave"},
+	}
+	for _, tt := range tests {
+		// Go randomizes map iteration, so the order must hold on every run
+		for run := 0; run < 20; run++ {
+			if got := names(tt.it()); got != tt.want {
+				t.Fatalf("%s: run %d gave %q, want %q", tt.name, run, got, tt.want)
+			}
+		}
+	}
+	sorted := Collect(profiles.CreateSortedIterator(byName))
+	if sorted[1].ID != 1 || sorted[2].ID != 5 {
+		t.Errorf("profiles with equal names came out as IDs %d, %d, want 1, 5", sorted[1].ID, sorted[2].ID)
+	}
+}
+
+func TestOrderedMapCollection(t *testing.T) {
+	var m OrderedMapCollection[string, int]
+	m.Set("c", 1)
+	m.Set("a", 2)
+	m.Set("b", 3)
+	m.Set("c", 4) // keeps its place
+	m.Delete("a")
+	m.Delete("missing")
+	m.Set("a", 5) // moves to the end
+	if got, want := Collect(m.CreateIterator()), []int{4, 3, 5}; !slices.Equal(got, want) {
+		t.Errorf("values = %v, want %v", got, want)
+	}
+	if m.Len() != 3 {
+		t.Errorf("Len = %d, want 3", m.Len())
+	}
+	if v, ok := m.Get("c"); v != 4 || !ok {
+		t.Errorf(`Get("c") = %d, %v`, v, ok)
+	}
+	if _, ok := m.Get("missing"); ok {
+		t.Error(`Get("missing") found a value`)
+	}
+}
+
+func TestOrderedMapMatchesInsertionOrder(t *testing.T) {
+	const seed = 1
+	r := rand.New(rand.NewSource(seed))
+	var m OrderedMapCollection[int, int]
+	var order []int // keys by first insertion since their last deletion
+	values := map[int]int{}
+	for i := 0; i < 2000; i++ {
+		key := r.Intn(50)
+		if r.Intn(3) == 0 {
+			m.Delete(key)
+			order = slices.DeleteFunc(order, func(k int) bool { return k == key })
+			delete(values, key)
+			continue
+		}
+		m.Set(key, i)
+		if _, ok := values[key]; !ok {
+			order = append(order, key)
+		}
+		values[key] = i
+	}
+	want := make([]int, len(order))
+	for i, k := range order {
+		want[i] = values[k]
+	}
+	if got := Collect(m.CreateIterator()); !slices.Equal(got, want) {
+		t.Fatalf("seed %d: values = %v, want %v", seed, got, want)
+	}
+}
+
+func TestMapIteratorsAreSnapshots(t *testing.T) {
+	sorted := &MapCollection[int, string]{items: map[int]string{1: "a", 2: "b", 3: "c"}}
+	var ordered OrderedMapCollection[int, string]
+	for _, k := range []int{3, 1, 2} {
+		ordered.Set(k, fmt.Sprint("v", k))
+	}
+	tests := []struct {
+		name   string
+		it     Iterator[string]
+		change func()
+		want   []string
+	}{
+		{"sorted map", sorted.CreateIterator(), func() {
+			delete(sorted.items, 3)
+			sorted.items[0] = "new"
+			sorted.items[2] = "changed"
+		}, []string{"a", "b", "c"}},
+		{"insertion-ordered map", ordered.CreateIterator(), func() {
+			ordered.Delete(2)
+			ordered.Set(9, "new")
+			ordered.Set(1, "changed")
+		}, []string{"v3", "v1", "v2"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for tt.it.HasNext() {
+			got = append(got, tt.it.Next())
+			// Change the map in the middle of the iteration
+			tt.change()
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: iterated %q while it changed, want %q", tt.name, got, tt.want)
+		}
+	}
+	// New iterators see the changes
+	if got, want := Collect(sorted.CreateIterator()), []string{"new", "a", "changed"}; !slices.Equal(got, want) {
+		t.Errorf("sorted map after the changes: %q, want %q", got, want)
+	}
+	if got, want := Collect(ordered.CreateIterator()), []string{"v3", "changed", "new"}; !slices.Equal(got, want) {
+		t.Errorf("insertion-ordered map after the changes: %q, want %q", got, want)
+	}
+}
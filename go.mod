@@ -1,3 +1,3 @@
 module github.com/araujo88/design-patterns-in-go/tree/main
 
-go 1.20
+go 1.21